@@ -17,10 +17,12 @@ package sqlxadapter
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/casbin/casbin/v3/model"
 	"github.com/casbin/casbin/v3/persist"
@@ -33,6 +35,9 @@ const defaultTableName = "casbin_rule"
 // maxParamLength  .
 const maxParamLength = 7
 
+// defaultCopyThreshold  the default min rows to insert by "COPY FROM STDIN".
+const defaultCopyThreshold = 1000
+
 // CasbinRule  defines the casbin rule model.
 // It used for save or load policy lines from sqlx connected database.
 type CasbinRule struct {
@@ -45,24 +50,119 @@ type CasbinRule struct {
 	V5    string `db:"v5"`
 }
 
+// nullableRule  defines the casbin rule model with nullable columns,
+// Oracle stores empty strings as NULL.
+type nullableRule struct {
+	PType sql.NullString `db:"p_type"`
+	V0    sql.NullString `db:"v0"`
+	V1    sql.NullString `db:"v1"`
+	V2    sql.NullString `db:"v2"`
+	V3    sql.NullString `db:"v3"`
+	V4    sql.NullString `db:"v4"`
+	V5    sql.NullString `db:"v5"`
+}
+
 // Adapter  define the sqlx adapter for Casbin.
 // It can load policy lines or save policy lines from sqlx connected database.
 type Adapter struct {
 	db        *sqlx.DB
 	ctx       context.Context
 	tableName string
+	dialect   Dialect
+	retry     *RetryPolicy
+	strict    bool
+	stmts     *stmtCache
+	life      *lifecycle
+
+	// writeHooks  run in the transaction of every write, after the rules are written.
+	writeHooks []func(ctx context.Context, tx *sqlx.Tx, changes []*Change) error
+
+	copyThreshold int
+
+	wipeGuard   bool
+	wipeAllowed []string
 
 	isFiltered bool
 
-	sqlCreateTable  string
-	sqlIsTableExist string
-	sqlInsertRow    string
-	sqlUpdateRow    string
-	sqlDeleteAll    string
-	sqlDeleteRow    string
-	sqlDeleteByArgs string
-	sqlSelectAll    string
-	sqlSelectWhere  string
+	indexes []Index
+
+	sqlCreateTable   string
+	sqlCreateIndexes []string
+	sqlIsTableExist  string
+	sqlInsertRow     string
+	sqlInsertRows    string
+	sqlInsertValues  string
+	sqlCopyIn        string
+	sqlUpdateRow     string
+	sqlDeleteAll     string
+	sqlDeleteRow     string
+	sqlDeleteByArgs  string
+	sqlDeleteRows    string
+	sqlDeleteRowsEnd string
+	sqlSelectAll     string
+	sqlSelectWhere   string
+
+	// sqlSelectLoad and sqlSelectLoadWhere  the statements of the loads, their head args are loadArgs.
+	sqlSelectLoad      string
+	sqlSelectLoadWhere string
+	// sqlSelectReplaced  select the rows which are cleared by SavePolicy and copied by CreateSnapshot.
+	sqlSelectReplaced string
+
+	// sqlDeleteReturning and sqlReturning  the prefix and the suffix of the delete statement
+	// which returns the deleted rows, sqlDeleteReturning is empty if the dialect does not support it.
+	sqlDeleteReturning string
+	sqlReturning       string
+
+	// the version table of the Watcher, version is set by WithVersion,
+	// the statements are empty if the version table is not enabled.
+	version          bool
+	sqlSelectVersion string
+	sqlBumpVersion   string
+
+	// notify and notifyChannel  are set by WithNotify.
+	notify        bool
+	notifyChannel string
+
+	// the change log table, changelog is set by WithChangelog.
+	changelog          bool
+	origin             string
+	sqlInsertChangelog string
+	sqlSelectChangelog string
+	sqlPurgeChangelog  string
+
+	// scope  the condition which every read, update and delete is restricted to,
+	// tombstone  the column which is set to the time of the removal instead of deleting the rows,
+	// they are set by the modes.
+	scope     string
+	tombstone string
+
+	// history  the history mode, the rows are versioned by valid_from and valid_to.
+	history       bool
+	sqlSelectAsOf string
+
+	// softDelete  the soft delete mode, the removed rows are kept with deleted_at.
+	softDelete       bool
+	sqlSelectRule    string
+	sqlDeleteRemoved string
+	sqlPurgeDeleted  string
+
+	// expiry  the expiry mode, the rows are valid in [valid_from, expires_at).
+	expiry                   bool
+	sqlSelectWindowed        string
+	sqlPurgeExpired          string
+	sqlPurgeExpiredReturning string
+	sqlSelectExpired         string
+	sqlSelectValidRule       string
+
+	// tenantColumn  the tenant mode, the rows are restricted by the tenant_id column,
+	// tenant  the tenant id of the Adapter returned by ForTenant.
+	tenantColumn bool
+	tenant       string
+
+	// the audit table, audit is set by WithAudit.
+	audit          bool
+	sqlInsertAudit string
+	sqlSelectAudit string
 }
 
 // Filter  defines the filtering rules for a FilteredAdapter's policy.
@@ -80,14 +180,14 @@ type Filter struct {
 // NewAdapter  the constructor for Adapter.
 // db should connected to database and controlled by user.
 // If tableName == "", the Adapter will automatically create a table named "casbin_rule".
-func NewAdapter(db *sqlx.DB, tableName string) (*Adapter, error) {
-	return NewAdapterContext(context.Background(), db, tableName)
+func NewAdapter(db *sqlx.DB, tableName string, opts ...Option) (*Adapter, error) {
+	return NewAdapterContext(context.Background(), db, tableName, opts...)
 }
 
 // NewAdapterContext  the constructor for Adapter.
 // db should connected to database and controlled by user.
 // If tableName == "", the Adapter will automatically create a table named "casbin_rule".
-func NewAdapterContext(ctx context.Context, db *sqlx.DB, tableName string) (*Adapter, error) {
+func NewAdapterContext(ctx context.Context, db *sqlx.DB, tableName string, opts ...Option) (*Adapter, error) {
 	if db == nil {
 		return nil, errors.New("db is nil")
 	}
@@ -98,169 +198,892 @@ func NewAdapterContext(ctx context.Context, db *sqlx.DB, tableName string) (*Ada
 		return nil, err
 	}
 
-	switch db.DriverName() {
-	case "oci8", "ora", "goracle":
-		return nil, errors.New("sqlxadapter: please checkout 'oracle' branch")
-	}
-
 	if tableName == "" {
 		tableName = defaultTableName
 	}
 
 	adapter := Adapter{
-		db:        db,
-		ctx:       ctx,
-		tableName: tableName,
+		db:            db,
+		ctx:           ctx,
+		tableName:     tableName,
+		copyThreshold: defaultCopyThreshold,
+		life:          &lifecycle{},
 	}
 
-	// generate different databases sql
-	adapter.genSQL()
+	for _, opt := range opts {
+		opt(&adapter)
+	}
+
+	if adapter.dialect == "" {
+		if adapter.dialect, err = detectDialect(ctx, db); err != nil {
+			return nil, err
+		}
+	} else if !adapter.dialect.isValid() {
+		return nil, fmt.Errorf("sqlxadapter: invalid dialect %q", adapter.dialect)
+	}
+
+	if adapter.retry == nil {
+		retry := defaultRetryPolicy(adapter.dialect)
+		adapter.retry = &retry
+	}
+
+	if adapter.indexes == nil {
+		adapter.indexes = []Index{{Name: "idx_" + tableName, Columns: []string{"p_type", "v0", "v1"}}}
+	}
+
+	if err = adapter.checkIndexes(); err != nil {
+		return nil, err
+	}
+
+	if adapter.history && adapter.softDelete {
+		return nil, errors.New("sqlxadapter: WithHistory and WithSoftDelete can not be used together")
+	}
+
+	if adapter.history && adapter.expiry {
+		return nil, errors.New("sqlxadapter: WithHistory and WithExpiry can not be used together")
+	}
 
-	if !adapter.isTableExist() {
+	adapter.genModeSQL()
+
+	if !adapter.isTableExist(adapter.sqlIsTableExist) {
 		if err = adapter.createTable(); err != nil {
 			return nil, err
 		}
 	}
 
+	if adapter.history {
+		if err = adapter.addColumns(ctx, historyColumns...); err != nil {
+			return nil, err
+		}
+	}
+
+	if adapter.softDelete {
+		if err = adapter.addColumns(ctx, softDeleteColumns...); err != nil {
+			return nil, err
+		}
+	}
+
+	if adapter.expiry {
+		if err = adapter.addColumns(ctx, expiryColumns...); err != nil {
+			return nil, err
+		}
+	}
+
+	if adapter.tenantColumn {
+		if err = adapter.addColumns(ctx, tenantColumns...); err != nil {
+			return nil, err
+		}
+	}
+
+	if adapter.version {
+		if err = adapter.enableVersion(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if adapter.changelog {
+		if err = adapter.enableChangelog(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if adapter.notify {
+		if err = adapter.enableNotify(); err != nil {
+			return nil, err
+		}
+	}
+
+	if adapter.audit {
+		if err = adapter.enableAudit(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	return &adapter, nil
 }
 
-// genSQL  generate sql based on db driver name.
+// genModeSQL  set the scope of the modes and generate different databases sql.
+func (p *Adapter) genModeSQL() {
+	p.scope = ""
+	p.tombstone = ""
+
+	if p.tenantColumn {
+		p.addScope(p.tenantCondition())
+	}
+
+	if p.history {
+		p.enableHistory()
+	}
+
+	if p.softDelete {
+		p.enableSoftDelete()
+	}
+
+	// generate different databases sql
+	p.genSQL()
+}
+
+// checkIndexes  check the index names and columns, and generate the empty names.
+func (p *Adapter) checkIndexes() error {
+	for idx := range p.indexes {
+		index := &p.indexes[idx]
+
+		if len(index.Columns) == 0 {
+			return fmt.Errorf("sqlxadapter: index[%d] has no columns", idx)
+		}
+
+		var keyLength int
+
+		for _, col := range index.Columns {
+			if !p.isRuleColumn(col) {
+				return fmt.Errorf("sqlxadapter: index[%d] has invalid column %q", idx, col)
+			}
+
+			keyLength += ruleColumnLength(col)
+		}
+
+		// the key of the hash index is the hash of the columns.
+		if charBytes, maxBytes := p.dialect.indexKeyLimit(); maxBytes > 0 && !index.Hash && keyLength*charBytes > maxBytes {
+			return fmt.Errorf("sqlxadapter: index[%d] key is %d bytes, exceeds the limit of %d bytes of %s, set Index.Hash to index the hash",
+				idx, keyLength*charBytes, maxBytes, p.dialect)
+		}
+
+		if index.Name == "" {
+			prefix := "idx_"
+			if index.Unique {
+				prefix = "uidx_"
+			}
+
+			index.Name = prefix + p.tableName + "_" + strings.Join(index.Columns, "_")
+		} else if !isIdentifier(index.Name) {
+			return fmt.Errorf("sqlxadapter: index[%d] has invalid name %q", idx, index.Name)
+		}
+	}
+
+	return nil
+}
+
+// genCreateIndexes  generate the index definitions with the format,
+// the format args are [1]unique keyword, [2]index name, [3]table name and [4]columns.
+// The hash indexes are generated by genHashIndexes.
+func (p *Adapter) genCreateIndexes(format string) []string {
+	indexes := make([]string, 0, len(p.indexes))
+
+	for _, index := range p.indexes {
+		if p.isHashIndex(&index) {
+			continue
+		}
+
+		var unique string
+		if index.Unique {
+			unique = "UNIQUE "
+		}
+
+		indexes = append(indexes, fmt.Sprintf(format, unique, index.Name, p.tableName, strings.Join(index.Columns, ",")))
+	}
+
+	return indexes
+}
+
+// isHashIndex  check the index is created on the hash of the columns,
+// only the dialects which limit the index key index the hash.
+func (p *Adapter) isHashIndex(index *Index) bool {
+	_, maxBytes := p.dialect.indexKeyLimit()
+
+	return index.Hash && maxBytes > 0
+}
+
+// genHashIndexes  generate the statements which add the hash column by the format and create the index on it,
+// the format args are [1]table name, [2]hash column and [3]columns, they run after the table is created.
+func (p *Adapter) genHashIndexes(format string) []string {
+	var queries []string
+
+	for _, index := range p.indexes {
+		if !p.isHashIndex(&index) {
+			continue
+		}
+
+		columns := strings.Join(index.Columns, ",")
+		if p.dialect == DialectSqlserver {
+			columns = strings.Join(index.Columns, ",NCHAR(0),") + ",NCHAR(0)"
+		}
+
+		var unique string
+		if index.Unique {
+			unique = "UNIQUE "
+		}
+
+		hashColumn := "h_" + index.Name
+
+		queries = append(queries,
+			fmt.Sprintf(format, p.tableName, hashColumn, columns),
+			fmt.Sprintf(sqlCreateIndex, unique, index.Name, p.tableName, hashColumn))
+	}
+
+	return queries
+}
+
+// genSQL  generate sql based on db dialect.
 func (p *Adapter) genSQL() {
 	p.sqlCreateTable = fmt.Sprintf(sqlCreateTable, p.tableName)
+	p.sqlCreateIndexes = p.genCreateIndexes(sqlCreateIndex)
 
 	p.sqlIsTableExist = fmt.Sprintf(sqlIsTableExist, p.tableName)
 
-	p.sqlInsertRow = fmt.Sprintf(sqlInsertRow, p.tableName)
+	columns, values := p.insertColumns()
+
+	p.sqlInsertRows = fmt.Sprintf(sqlInsertRows, p.tableName, columns)
+	p.sqlInsertValues = fmt.Sprintf(sqlInsertValues, values)
+	p.sqlInsertRow = p.sqlInsertRows + p.sqlInsertValues
 	p.sqlUpdateRow = fmt.Sprintf(sqlUpdateRow, p.tableName)
 	p.sqlDeleteAll = fmt.Sprintf(sqlDeleteAll, p.tableName)
 	p.sqlDeleteRow = fmt.Sprintf(sqlDeleteRow, p.tableName)
 	p.sqlDeleteByArgs = fmt.Sprintf(sqlDeleteByArgs, p.tableName)
+	p.sqlDeleteRows = fmt.Sprintf(sqlDeleteRows, p.tableName)
+	p.sqlDeleteRowsEnd = sqlDeleteRowsEnd
 
 	p.sqlSelectAll = fmt.Sprintf(sqlSelectAll, p.tableName)
 	p.sqlSelectWhere = fmt.Sprintf(sqlSelectWhere, p.tableName)
 
-	switch p.db.DriverName() {
-	case "postgres", "pgx", "pq-timeouts", "cloudsql-postgres", "ql", "nrpostgres", "cockroach":
+	switch p.dialect {
+	case DialectPostgres, DialectCockroach:
 		p.sqlCreateTable = fmt.Sprintf(sqlCreateTablePostgres, p.tableName)
-		p.sqlInsertRow = fmt.Sprintf(sqlInsertRowPostgres, p.tableName)
-		p.sqlUpdateRow = fmt.Sprintf(sqlUpdateRowPostgres, p.tableName)
-		p.sqlDeleteRow = fmt.Sprintf(sqlDeleteRowPostgres, p.tableName)
-	case "mysql", "nrmysql":
-		p.sqlCreateTable = fmt.Sprintf(sqlCreateTableMysql, p.tableName)
-	case "sqlite", "sqlite3":
+		p.sqlCreateIndexes = p.genCreateIndexes(sqlCreateIndexPostgres)
+		p.sqlReturning = sqlReturning
+
+		// only github.com/lib/pq supports "COPY FROM STDIN" by database/sql.
+		if p.dialect == DialectPostgres && strings.HasPrefix(driverPkgPath(p.db.Driver()), "github.com/lib/pq") {
+			p.sqlCopyIn = fmt.Sprintf(sqlCopyInPostgres, p.tableName, columns)
+		}
+	case DialectMysql:
+		// the indexes may cover the tenant_id column which is added after the table is created.
+		if p.tenantColumn {
+			p.sqlCreateTable = fmt.Sprintf(sqlCreateTableMysql, p.tableName, "")
+		} else {
+			p.sqlCreateTable = fmt.Sprintf(sqlCreateTableMysql, p.tableName, strings.Join(p.genCreateIndexes(sqlCreateIndexMysql), ""))
+			p.sqlCreateIndexes = nil
+		}
+
+		p.sqlCreateIndexes = append(p.sqlCreateIndexes, p.genHashIndexes(sqlAddHashColumnMysql)...)
+	case DialectSqlite3:
 		p.sqlCreateTable = fmt.Sprintf(sqlCreateTableSqlite3, p.tableName)
-	case "sqlserver", "azuresql":
+		p.sqlCreateIndexes = p.genCreateIndexes(sqlCreateIndexSqlite3)
+		p.sqlReturning = sqlReturning
+	case DialectSqlserver:
 		p.sqlCreateTable = fmt.Sprintf(sqlCreateTableSqlserver, p.tableName)
-		p.sqlInsertRow = fmt.Sprintf(sqlInsertRowSqlserver, p.tableName)
-		p.sqlUpdateRow = fmt.Sprintf(sqlUpdateRowSqlserver, p.tableName)
-		p.sqlDeleteRow = fmt.Sprintf(sqlDeleteRowSqlserver, p.tableName)
+		p.sqlCreateIndexes = append(p.sqlCreateIndexes, p.genHashIndexes(sqlAddHashColumnSqlserver)...)
+		p.sqlDeleteReturning = fmt.Sprintf(sqlDeleteReturningSqlserver, p.tableName)
+		p.sqlDeleteRows = fmt.Sprintf(sqlDeleteRowsSqlserver, p.tableName)
+		p.sqlDeleteRowsEnd = sqlDeleteRowsEndSqlserver
+	case DialectOracle:
+		p.sqlCreateTable = fmt.Sprintf(sqlCreateTableOracle, p.tableName)
+		p.sqlIsTableExist = fmt.Sprintf(sqlIsTableExistOracle, p.tableName)
+		p.sqlUpdateRow = fmt.Sprintf(sqlUpdateRowOracle, p.tableName)
+		p.sqlDeleteRow = fmt.Sprintf(sqlDeleteRowOracle, p.tableName)
+		p.sqlDeleteRows = ""
+	case DialectDuckdb:
+		p.sqlCreateTable = fmt.Sprintf(sqlCreateTableDuckdb, p.tableName)
+		p.sqlCreateIndexes = p.genCreateIndexes(sqlCreateIndexDuckdb)
+		p.sqlIsTableExist = fmt.Sprintf(sqlIsTableExistDuckdb, p.tableName)
+		p.sqlReturning = sqlReturning
+	case DialectGeneric:
+	}
+
+	if p.tombstone != "" {
+		p.genTombstoneSQL()
 	}
+
+	if p.scope != "" {
+		p.genScopeSQL()
+	}
+
+	if p.softDelete {
+		p.genSoftDeleteSQL()
+	}
+
+	p.sqlSelectLoad = p.sqlSelectAll
+	p.sqlSelectLoadWhere = p.sqlSelectWhere
+	p.sqlSelectReplaced = p.sqlSelectAll
+
+	if p.expiry {
+		p.genExpirySQL()
+	}
+
+	// the dialects which support "RETURNING" return the deleted rows by the delete statement.
+	if p.sqlReturning != "" {
+		p.sqlDeleteReturning = p.sqlDeleteByArgs
+	}
+
+	p.sqlInsertRow = p.dialect.rebind(p.sqlInsertRow)
+	p.sqlUpdateRow = p.dialect.rebind(p.sqlUpdateRow)
+	p.sqlDeleteRow = p.dialect.rebind(p.sqlDeleteRow)
 }
 
-// createTable  create a not exists table.
+// createTable  create a not exists table and the indexes,
+// in the tenant mode the tenant_id column is added before the indexes which may cover it.
 func (p *Adapter) createTable() error {
 	_, err := p.db.ExecContext(p.ctx, p.sqlCreateTable)
+	if err != nil {
+		return err
+	}
 
-	return err
-}
+	if p.tenantColumn {
+		if err = p.addColumns(p.ctx, tenantColumns...); err != nil {
+			return err
+		}
+	}
 
-// deleteAll  clear the table.
-func (p *Adapter) deleteAll() error {
-	_, err := p.db.ExecContext(p.ctx, p.sqlDeleteAll)
+	for _, query := range p.sqlCreateIndexes {
+		if _, err = p.db.ExecContext(p.ctx, query); err != nil {
+			return err
+		}
+	}
 
-	return err
+	return nil
 }
 
-// isTableExist  check the table exists.
-func (p *Adapter) isTableExist() bool {
-	_, err := p.db.ExecContext(p.ctx, p.sqlIsTableExist)
+// isTableExist  check the table exists by the query.
+func (p *Adapter) isTableExist(query string) bool {
+	if p.dialect == DialectOracle || p.dialect == DialectDuckdb {
+		var count int
+		err := p.db.GetContext(p.ctx, &count, query)
+
+		return err == nil && count > 0
+	}
+
+	_, err := p.db.ExecContext(p.ctx, query)
 
 	return err == nil
 }
 
-// deleteRows  delete eligible data.
-func (p *Adapter) deleteRows(query string, args ...interface{}) error {
-	query = p.db.Rebind(query)
+// ensureTable  create the table and the indexes by the queries if the table does not exist,
+// the table may be created by another instance at the same time.
+func (p *Adapter) ensureTable(ctx context.Context, table, sqlCreate string, sqlCreateIndexes ...string) error {
+	query := fmt.Sprintf(sqlIsTableExist, table)
+
+	switch p.dialect {
+	case DialectOracle:
+		query = fmt.Sprintf(sqlIsTableExistOracle, table)
+	case DialectDuckdb:
+		query = fmt.Sprintf(sqlIsTableExistDuckdb, table)
+	case DialectGeneric, DialectPostgres, DialectCockroach, DialectMysql, DialectSqlite3, DialectSqlserver:
+	}
+
+	if p.isTableExist(query) {
+		return nil
+	}
+
+	if _, err := p.db.ExecContext(ctx, sqlCreate); err != nil {
+		if p.isTableExist(query) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, sqlCreateIndex := range sqlCreateIndexes {
+		if _, err := p.db.ExecContext(ctx, sqlCreateIndex); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteRows  delete eligible data, returns the affected rows.
+// If mustAffect is true, it fails with ErrNotFound if no row is deleted.
+func (p *Adapter) deleteRows(ctx context.Context, changes []*Change, mustAffect bool, query string, args ...interface{}) (int64, error) {
+	return p.exec(ctx, changes, mustAffect, p.dialect.rebind(query), append(p.deleteArgs(time.Now().UnixNano()), args...)...)
+}
+
+// exec  exec a single statement and returns the affected rows, it will be retried by the retry policy,
+// the statement runs in its own implicit transaction, so it is safe to replay.
+// If there are write hooks, the statement runs in a transaction with them,
+// the write hooks are skipped if no row is affected.
+// If mustAffect is true, it fails with ErrNotFound if no row is affected, the transaction is rolled back.
+func (p *Adapter) exec(ctx context.Context, changes []*Change, mustAffect bool, query string, args ...interface{}) (int64, error) {
+	var affected int64
+
+	fn := func(tx *sqlx.Tx) error {
+		result, err := p.execQuery(ctx, tx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		affected, err = result.RowsAffected()
+		if err == nil && mustAffect && affected == 0 {
+			err = ErrNotFound
+		}
+
+		return err
+	}
+
+	if len(p.writeHooks) > 0 {
+		err := p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+			err := fn(tx)
+
+			return affectedChanges(changes, affected), err
+		})
+
+		return affected, err
+	}
+
+	err := p.retry.do(ctx, p.dialect, func() error {
+		return fn(nil)
+	})
+
+	return affected, err
+}
+
+// execQuery  exec the query by the cached statement if the statement cache is enabled,
+// it runs in the transaction if tx != nil.
+func (p *Adapter) execQuery(ctx context.Context, tx *sqlx.Tx, query string, args ...interface{}) (sql.Result, error) {
+	if p.stmts == nil {
+		if tx == nil {
+			return p.db.ExecContext(ctx, query, args...)
+		}
+
+		return tx.ExecContext(ctx, query, args...)
+	}
+
+	stmt, err := p.stmts.get(ctx, p.db, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if tx == nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+
+	txStmt := tx.StmtxContext(ctx, stmt)
+	defer txStmt.Close()
+
+	return txStmt.ExecContext(ctx, args...)
+}
+
+// deleteAllAndInsertRows  clear table and insert new rows in a transaction.
+func (p *Adapter) deleteAllAndInsertRows(ctx context.Context, changes []*Change, rules [][]interface{}) error {
+	return p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+		replaced, err := p.replaceRows(ctx, tx, rules)
+
+		return append(changes[:len(changes):len(changes)], replaced...), err
+	})
+}
+
+// replaceRows  clear table and insert new rows in the transaction,
+// in the history mode the new rows are valid from the time the old rows are closed.
+// The time-bounded rows of the expiry mode are kept.
+// If the audit is enabled, it returns the audit only changes of the removed and the added rules.
+func (p *Adapter) replaceRows(ctx context.Context, tx *sqlx.Tx, rules [][]interface{}) ([]*Change, error) {
+	var oldRows []*CasbinRule
+
+	if p.audit {
+		var err error
+		if oldRows, err = p.queryRows(ctx, tx, p.sqlSelectReplaced, p.scopeArgs()...); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UnixNano()
+
+	if _, err := tx.ExecContext(ctx, p.dialect.rebind(p.sqlDeleteAll), p.deleteArgs(now)...); err != nil {
+		return nil, err
+	}
+
+	if p.expiry {
+		var err error
+		if rules, err = p.skipWindowedRows(ctx, tx, rules); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.insertRows(ctx, tx, rules, now); err != nil || !p.audit {
+		return nil, err
+	}
+
+	removed, added := diffRules(oldRows, rules)
+
+	return append(newAuditChanges(OpRemovePolicy, removed), newAuditChanges(OpAddPolicy, added)...), nil
+}
+
+// diffRules  get the rules of the rows which are not in the args, and the rules of the args which are not in the rows,
+// the rules start with the ptype.
+func diffRules(rows []*CasbinRule, args [][]interface{}) (removed, added [][]string) {
+	oldRules := make(map[string]struct{}, len(rows))
+	for _, row := range rows {
+		oldRules[strings.Join(row.toRule(), "\x00")] = struct{}{}
+	}
 
-	_, err := p.db.ExecContext(p.ctx, query, args...)
+	for _, arg := range args {
+		rule := argsToRule(arg)
+		key := strings.Join(rule, "\x00")
+
+		if _, ok := oldRules[key]; ok {
+			delete(oldRules, key)
+		} else {
+			added = append(added, rule)
+		}
+	}
+
+	for _, row := range rows {
+		rule := row.toRule()
+		key := strings.Join(rule, "\x00")
+
+		if _, ok := oldRules[key]; ok {
+			delete(oldRules, key)
+			removed = append(removed, rule)
+		}
+	}
+
+	return removed, added
+}
+
+// execTxSQLRows  exec sql rows in a transaction, returns the total affected rows.
+// If mustAffect is true, a rule which affects no row fails the transaction with ErrNotFound.
+// The write hooks are skipped if no row is affected.
+func (p *Adapter) execTxSQLRows(ctx context.Context, changes []*Change, query string, head []interface{}, rules [][]interface{}, mustAffect bool) (int64, error) {
+	var affected int64
+
+	err := p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+		var err error
+
+		affected, err = p.execStmtRows(ctx, tx, query, head, rules, mustAffect)
+
+		return affectedChanges(changes, affected), err
+	})
+
+	return affected, err
+}
+
+// affectedChanges  returns the changes if any row is affected, otherwise nil, so the write hooks are skipped.
+func affectedChanges(changes []*Change, affected int64) []*Change {
+	if affected == 0 {
+		return nil
+	}
+
+	return changes
+}
+
+// insertRows  insert the rows in the transaction by the multi-row INSERT statements,
+// the rows are batched by the max rows of the dialect, now is the valid_from of the history mode.
+func (p *Adapter) insertRows(ctx context.Context, tx *sqlx.Tx, rules [][]interface{}, now int64) error {
+	rules = p.insertArgs(rules, now)
+
+	if p.sqlCopyIn != "" && p.copyThreshold > 0 && len(rules) >= p.copyThreshold {
+		return p.copyRows(ctx, tx, rules)
+	}
+
+	if len(rules) <= 1 || p.dialect.maxBatchRows(len(rules[0])) <= 1 {
+		_, err := p.execStmtRows(ctx, tx, p.sqlInsertRow, nil, rules, false)
+
+		return err
+	}
+
+	_, err := p.execBatchRows(ctx, tx, p.sqlInsertRows, p.sqlInsertValues, "", nil, nil, rules)
 
 	return err
 }
 
-// deleteAllAndInsertRows  clear table and insert new rows.
-func (p *Adapter) deleteAllAndInsertRows(rules [][]interface{}) error {
-	if err := p.deleteAll(); err != nil {
+// deleteRowsBatch  delete the rows in the transaction by the set-based DELETE statements,
+// returns the total affected rows, the rows are batched by the max rows of the dialect.
+// The dialects which do not support it delete the rows one by one.
+func (p *Adapter) deleteRowsBatch(ctx context.Context, tx *sqlx.Tx, rules [][]interface{}) (int64, error) {
+	now := time.Now().UnixNano()
+	head := p.deleteArgs(now)
+
+	if p.sqlDeleteRows == "" || len(rules) <= 1 || p.dialect.maxBatchRows(maxParamLength+len(head)) <= 1 {
+		return p.execStmtRows(ctx, tx, p.sqlDeleteRow, head, rules, false)
+	}
+
+	if p.dialect == DialectSqlserver {
+		// the scope condition is after the rows values.
+		return p.execBatchRows(ctx, tx, p.sqlDeleteRows, sqlRowValues, p.sqlDeleteRowsEnd, p.tombstoneArgs(now), p.scopeArgs(), rules)
+	}
+
+	return p.execBatchRows(ctx, tx, p.sqlDeleteRows, sqlRowValues, p.sqlDeleteRowsEnd, head, nil, rules)
+}
+
+// execBatchRows  exec the statements which contain the rows values "(?,?,?,?,?,?,?),(...)"
+// between prefix and suffix, returns the total affected rows.
+// The head args are bound before the rows values in every statement.
+// The batches are also limited by the estimated bytes of the rows if the dialect limits the packet size.
+func (p *Adapter) execBatchRows(ctx context.Context, tx *sqlx.Tx, prefix, rowValues, suffix string, head, tail []interface{}, rules [][]interface{}) (int64, error) {
+	// a row is reserved for every head and tail arg.
+	batchRows := p.dialect.maxBatchRows(len(rules[0])) - len(head) - len(tail)
+	if batchRows > len(rules) {
+		batchRows = len(rules)
+	}
+
+	maxBytes := p.dialect.maxBatchBytes()
+
+	var (
+		query     string
+		queryRows int
+		total     int64
+	)
+
+	args := make([]interface{}, 0, len(head)+batchRows*len(rules[0])+len(tail))
+
+	for start, end := 0, 0; start < len(rules); start = end {
+		end = start + batchRows
+		if end > len(rules) {
+			end = len(rules)
+		}
+
+		if maxBytes > 0 {
+			end = start + rowsWithinBytes(rules[start:end], maxBytes)
+		}
+
+		// the statement is reused while the batches have the same rows.
+		if end-start != queryRows {
+			query = p.genBatchSQL(prefix, rowValues, suffix, end-start)
+			queryRows = end - start
+		}
+
+		args = append(args[:0], head...)
+		for _, rule := range rules[start:end] {
+			args = append(args, rule...)
+		}
+
+		args = append(args, tail...)
+
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+
+		total += affected
+	}
+
+	return total, nil
+}
+
+// rowsWithinBytes  get the count of the leading rows whose estimated bytes are within maxBytes, it is at least 1.
+// Every arg is estimated by its length and the overhead of its placeholder and encoding.
+func rowsWithinBytes(rules [][]interface{}, maxBytes int) int {
+	var size int
+
+	for idx, rule := range rules {
+		for _, arg := range rule {
+			size += 16
+
+			if s, ok := arg.(string); ok {
+				size += len(s)
+			}
+		}
+
+		if size > maxBytes && idx > 0 {
+			return idx
+		}
+	}
+
+	return len(rules)
+}
+
+// copyRows  insert the rows in the transaction by "COPY FROM STDIN" of github.com/lib/pq,
+// the rows are sent by the prepared statement and flushed by the exec without args.
+func (p *Adapter) copyRows(ctx context.Context, tx *sqlx.Tx, rules [][]interface{}) error {
+	stmt, err := tx.PrepareContext(ctx, p.sqlCopyIn)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if _, err = stmt.ExecContext(ctx, rule...); err != nil {
+			_ = stmt.Close()
+
+			return &OpError{Rule: argsToRule(rule), Err: err}
+		}
+	}
+
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		_ = stmt.Close()
+
+		return err
+	}
+
+	return stmt.Close()
+}
+
+// genBatchSQL  generate the statement of n rows values between prefix and suffix.
+func (p *Adapter) genBatchSQL(prefix, rowValues, suffix string, n int) string {
+	var sqlBuf strings.Builder
+
+	sqlBuf.Grow(len(prefix) + n*(len(rowValues)+1) + len(suffix))
+	sqlBuf.WriteString(prefix)
+
+	for idx := 0; idx < n; idx++ {
+		if idx > 0 {
+			sqlBuf.WriteByte(',')
+		}
+
+		sqlBuf.WriteString(rowValues)
+	}
+
+	sqlBuf.WriteString(suffix)
+
+	return p.dialect.rebind(sqlBuf.String())
+}
+
+// execStmtRows  prepare the query in the transaction and exec it with every rule,
+// returns the total affected rows, the head args are bound before every rule.
+// If mustAffect is true, a rule which affects no row returns ErrNotFound.
+func (p *Adapter) execStmtRows(ctx context.Context, tx *sqlx.Tx, query string, head []interface{}, rules [][]interface{}, mustAffect bool) (int64, error) {
+	stmt, err := p.prepareTx(ctx, tx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+
+	args := make([]interface{}, 0, len(head)+maxParamLength*2)
+
+	for _, rule := range rules {
+		args = append(append(args[:0], head...), rule...)
+
+		result, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			_ = stmt.Close()
+
+			return total, &OpError{Rule: argsToRule(rule), Err: err}
+		}
+
+		affected, err := result.RowsAffected()
+		if err == nil && mustAffect && affected == 0 {
+			err = ErrNotFound
+		}
+
+		if err != nil {
+			_ = stmt.Close()
+
+			return total, &OpError{Rule: argsToRule(rule), Err: err}
+		}
+
+		total += affected
+	}
+
+	return total, stmt.Close()
+}
+
+// execTx  exec fn in a transaction, the whole transaction will be replayed
+// by the retry policy, so fn must not keep any state between the attempts.
+// The changes made by fn are passed to the write hooks.
+func (p *Adapter) execTx(ctx context.Context, changes []*Change, fn func(tx *sqlx.Tx) error) error {
+	return p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+		return changes, fn(tx)
+	})
+}
+
+// execTxChanges  the same as execTx, but the changes are returned by fn,
+// it is used when the changes are known after the rows are selected in the transaction.
+func (p *Adapter) execTxChanges(ctx context.Context, fn func(tx *sqlx.Tx) ([]*Change, error)) error {
+	return p.retry.do(ctx, p.dialect, func() error {
+		return p.execTxOnce(ctx, fn)
+	})
+}
+
+// execTxOnce  exec fn and the write hooks in a transaction, commit it if all of them succeed, otherwise rollback it.
+// The write hooks are skipped if there is no change of the policy rules.
+func (p *Adapter) execTxOnce(ctx context.Context, fn func(tx *sqlx.Tx) ([]*Change, error)) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	changes, err := fn(tx)
+
+	// the changes are recorded with the tenant of the Adapter.
+	for _, change := range changes {
+		change.Tenant = p.tenant
+	}
+
+	for idx := 0; err == nil && len(changes) > 0 && idx < len(p.writeHooks); idx++ {
+		err = p.writeHooks[idx](ctx, tx, changes)
+	}
+
+	if err != nil {
+		if err1 := tx.Rollback(); err1 != nil {
+			err = fmt.Errorf("exec err: %w, rollback err: %w", err, err1)
+		}
+
 		return err
 	}
-	return p.execTxSQLRows(p.sqlInsertRow, rules)
+
+	return tx.Commit()
 }
 
-// execTxSQLRows  exec sql rows.
-func (p *Adapter) execTxSQLRows(query string, rules [][]interface{}) error {
-	tx, err := p.db.BeginTx(p.ctx, nil)
-	if err != nil {
-		return err
+// selectRows  select eligible data by args from the table.
+func (p *Adapter) selectRows(ctx context.Context, query string, args ...interface{}) ([]*CasbinRule, error) {
+	if len(args) > 0 {
+		query = p.dialect.rebind(query)
 	}
 
-	var action string
+	var lines []*CasbinRule
 
-	stmt, err := tx.PrepareContext(p.ctx, query)
-	if err != nil {
-		action = "prepare context"
-		goto ROLLBACK
-	}
+	err := p.retry.do(ctx, p.dialect, func() error {
+		var err error
 
-	for _, rule := range rules {
-		if _, err = stmt.ExecContext(p.ctx, rule...); err != nil {
-			action = "stmt exec"
-			goto ROLLBACK
-		}
-	}
+		lines, err = p.queryRows(ctx, p.db, query, args...)
 
-	if err = stmt.Close(); err != nil {
-		action = "stmt close"
-		goto ROLLBACK
-	}
+		return err
+	})
 
-	if err = tx.Commit(); err != nil {
-		action = "commit"
-		goto ROLLBACK
-	}
+	return lines, err
+}
 
-	return err
+// queryRows  query the rows by the db or the transaction, the query must be rebound.
+func (p *Adapter) queryRows(ctx context.Context, q sqlx.QueryerContext, query string, args ...interface{}) ([]*CasbinRule, error) {
+	if p.dialect == DialectOracle {
+		return queryNullableRows(ctx, q, query, args...)
+	}
 
-ROLLBACK:
+	// make a slice with capacity
+	lines := make([]*CasbinRule, 0, 64)
 
-	if err1 := tx.Rollback(); err1 != nil {
-		err = fmt.Errorf("%s err: %w, rollback err: %w", action, err, err1)
+	if err := sqlx.SelectContext(ctx, q, &lines, query, args...); err != nil {
+		return nil, err
 	}
 
-	return err
+	return lines, nil
 }
 
-// selectRows  select eligible data by args from the table.
-func (p *Adapter) selectRows(query string, args ...interface{}) ([]*CasbinRule, error) {
-	// make a slice with capacity
-	lines := make([]*CasbinRule, 0, 64)
+// queryNullableRows  query the rows which columns may be NULL.
+func queryNullableRows(ctx context.Context, q sqlx.QueryerContext, query string, args ...interface{}) ([]*CasbinRule, error) {
+	rows := make([]*nullableRule, 0, 64)
 
-	if len(args) == 0 {
-		return lines, p.db.SelectContext(p.ctx, &lines, query)
+	if err := sqlx.SelectContext(ctx, q, &rows, query, args...); err != nil {
+		return nil, err
 	}
 
-	query = p.db.Rebind(query)
+	lines := make([]*CasbinRule, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, &CasbinRule{
+			PType: row.PType.String,
+			V0:    row.V0.String,
+			V1:    row.V1.String,
+			V2:    row.V2.String,
+			V3:    row.V3.String,
+			V4:    row.V4.String,
+			V5:    row.V5.String,
+		})
+	}
 
-	return lines, p.db.SelectContext(p.ctx, &lines, query, args...)
+	return lines, nil
 }
 
 // selectWhereIn  select eligible data by filter from the table.
-func (p *Adapter) selectWhereIn(filter *Filter) ([]*CasbinRule, error) {
+func (p *Adapter) selectWhereIn(ctx context.Context, filter *Filter) ([]*CasbinRule, error) {
 	var sqlBuf bytes.Buffer
 
 	sqlBuf.Grow(64)
-	sqlBuf.WriteString(p.sqlSelectWhere)
+	sqlBuf.WriteString(p.sqlSelectLoadWhere)
 
-	args := make([]interface{}, 0, 4)
+	args := append(make([]interface{}, 0, 4), p.loadArgs()...)
 
 	hasInCond := false
 
@@ -281,14 +1104,16 @@ func (p *Adapter) selectWhereIn(filter *Filter) ([]*CasbinRule, error) {
 			continue
 		}
 
-		switch sqlBuf.Bytes()[sqlBuf.Len()-1] {
-		case '?', ')':
+		if sqlBuf.Len() > len(p.sqlSelectLoadWhere) {
 			sqlBuf.WriteString(" AND ")
 		}
 
 		sqlBuf.WriteString(col.name)
 
-		if l == 1 {
+		if l == 1 && col.arg[0] == "" && p.dialect == DialectOracle {
+			// Oracle stores empty strings as NULL.
+			sqlBuf.WriteString(" IS NULL")
+		} else if l == 1 {
 			sqlBuf.WriteString("=?")
 			args = append(args, col.arg[0])
 		} else {
@@ -299,6 +1124,10 @@ func (p *Adapter) selectWhereIn(filter *Filter) ([]*CasbinRule, error) {
 		}
 	}
 
+	if sqlBuf.Len() == len(p.sqlSelectLoadWhere) {
+		return nil, fmt.Errorf("%w: no condition", ErrInvalidFilter)
+	}
+
 	var (
 		query string
 		err   error
@@ -311,19 +1140,29 @@ func (p *Adapter) selectWhereIn(filter *Filter) ([]*CasbinRule, error) {
 		query = sqlBuf.String()
 	}
 
-	return p.selectRows(query, args...)
+	return p.selectRows(ctx, query, args...)
 }
 
 // LoadPolicy  load all policy rules from the storage.
 func (p *Adapter) LoadPolicy(model model.Model) error {
-	lines, err := p.selectRows(p.sqlSelectAll)
+	return p.LoadPolicyCtx(p.ctx, model)
+}
+
+// LoadPolicyCtx  load all policy rules from the storage with context.
+func (p *Adapter) LoadPolicyCtx(ctx context.Context, model model.Model) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("LoadPolicy", nil, err)
+	}
+	defer p.release()
+
+	lines, err := p.selectRows(ctx, p.sqlSelectLoad, p.loadArgs()...)
 	if err != nil {
-		return err
+		return p.opError("LoadPolicy", nil, err)
 	}
 
 	for _, line := range lines {
 		if err = p.loadPolicyLine(line, model); err != nil {
-			return err
+			return p.opError("LoadPolicy", line.toRule(), err)
 		}
 	}
 
@@ -332,48 +1171,96 @@ func (p *Adapter) LoadPolicy(model model.Model) error {
 
 // SavePolicy  save policy rules to the storage.
 func (p *Adapter) SavePolicy(model model.Model) error {
-	args := make([][]interface{}, 0, 64)
+	return p.SavePolicyCtx(p.ctx, model)
+}
 
-	for ptype, ast := range model["p"] {
-		for _, rule := range ast.Policy {
-			arg := p.genArgs(ptype, rule)
-			args = append(args, arg)
-		}
+// SavePolicyCtx  save policy rules to the storage with context.
+func (p *Adapter) SavePolicyCtx(ctx context.Context, model model.Model) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("SavePolicy", nil, err)
 	}
+	defer p.release()
 
-	for ptype, ast := range model["g"] {
-		for _, rule := range ast.Policy {
-			arg := p.genArgs(ptype, rule)
-			args = append(args, arg)
+	args := make([][]interface{}, 0, 64)
+
+	for _, sec := range [...]string{"p", "g"} {
+		for ptype, ast := range model[sec] {
+			for _, rule := range ast.Policy {
+				arg, err := p.genArgs(ptype, rule)
+				if err != nil {
+					return p.opError("SavePolicy", append([]string{ptype}, rule...), err)
+				}
+
+				args = append(args, arg)
+			}
 		}
 	}
 
-	return p.deleteAllAndInsertRows(args)
+	changes := []*Change{{Op: OpSavePolicy}}
+
+	return p.opError("SavePolicy", nil, p.deleteAllAndInsertRows(ctx, changes, args))
 }
 
 // AddPolicy  add one policy rule to the storage.
 func (p *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
-	args := p.genArgs(ptype, rule)
+	return p.AddPolicyCtx(p.ctx, sec, ptype, rule)
+}
 
-	_, err := p.db.ExecContext(p.ctx, p.sqlInsertRow, args...)
+// AddPolicyCtx  add one policy rule to the storage with context.
+func (p *Adapter) AddPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("AddPolicy", nil, err)
+	}
+	defer p.release()
 
-	return err
+	args, err := p.genArgs(ptype, rule)
+	if err == nil {
+		changes := []*Change{{Op: OpAddPolicy, Sec: sec, PType: ptype, Rule: rule}}
+
+		_, err = p.exec(ctx, changes, false, p.sqlInsertRow, p.insertArgs([][]interface{}{args}, time.Now().UnixNano())[0]...)
+	}
+
+	return p.opError("AddPolicy", append([]string{ptype}, rule...), err)
 }
 
 // AddPolicies  add multiple policy rules to the storage.
 func (p *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
-	args := make([][]interface{}, 0, 8)
+	return p.AddPoliciesCtx(p.ctx, sec, ptype, rules)
+}
 
-	for _, rule := range rules {
-		arg := p.genArgs(ptype, rule)
-		args = append(args, arg)
+// AddPoliciesCtx  add multiple policy rules to the storage with context.
+func (p *Adapter) AddPoliciesCtx(ctx context.Context, sec string, ptype string, rules [][]string) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("AddPolicies", nil, err)
 	}
+	defer p.release()
 
-	return p.execTxSQLRows(p.sqlInsertRow, args)
+	args, err := p.genArgsList(ptype, rules)
+	if err == nil {
+		err = p.execTx(ctx, newChanges(OpAddPolicy, sec, ptype, rules), func(tx *sqlx.Tx) error {
+			return p.insertRows(ctx, tx, args, time.Now().UnixNano())
+		})
+	}
+
+	return p.opError("AddPolicies", nil, err)
 }
 
 // RemovePolicy  remove policy rules from the storage.
 func (p *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return p.RemovePolicyCtx(p.ctx, sec, ptype, rule)
+}
+
+// RemovePolicyCtx  remove policy rules from the storage with context.
+func (p *Adapter) RemovePolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("RemovePolicy", nil, err)
+	}
+	defer p.release()
+
+	if len(rule) >= maxParamLength {
+		return p.opError("RemovePolicy", append([]string{ptype}, rule...), ErrRuleTooLong)
+	}
+
 	var sqlBuf bytes.Buffer
 
 	sqlBuf.Grow(64)
@@ -392,72 +1279,223 @@ func (p *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
 		}
 	}
 
-	return p.deleteRows(sqlBuf.String(), args...)
+	changes := []*Change{{Op: OpRemovePolicy, Sec: sec, PType: ptype, Rule: rule}}
+
+	_, err := p.deleteRows(ctx, changes, p.strict, sqlBuf.String(), args...)
+
+	return p.opError("RemovePolicy", append([]string{ptype}, rule...), err)
 }
 
 // RemoveFilteredPolicy  remove policy rules that match the filter from the storage.
 func (p *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
-	var sqlBuf bytes.Buffer
+	_, err := p.RemoveFilteredPolicyAffected(p.ctx, sec, ptype, fieldIndex, fieldValues...)
 
-	sqlBuf.Grow(64)
-	sqlBuf.WriteString(p.sqlDeleteByArgs)
+	return err
+}
 
-	args := make([]interface{}, 0, 4)
-	args = append(args, ptype)
+// RemoveFilteredPolicyCtx  remove policy rules that match the filter from the storage with context.
+func (p *Adapter) RemoveFilteredPolicyCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	_, err := p.RemoveFilteredPolicyAffected(ctx, sec, ptype, fieldIndex, fieldValues...)
+
+	return err
+}
+
+// RemoveFilteredPolicyAffected  remove policy rules that match the filter from the storage,
+// returns the count of the removed rules.
+func (p *Adapter) RemoveFilteredPolicyAffected(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) (int64, error) {
+	if err := p.acquire(); err != nil {
+		return 0, p.opError("RemoveFilteredPolicy", nil, err)
+	}
+	defer p.release()
+
+	where, args, err := p.genFilteredWhere(ptype, fieldIndex, fieldValues)
+	if err != nil {
+		return 0, p.opError("RemoveFilteredPolicy", nil, err)
+	}
+
+	changes := []*Change{{Op: OpRemoveFilteredPolicy, Sec: sec, PType: ptype, FieldIndex: fieldIndex, Rule: fieldValues}}
+
+	var affected int64
+
+	if p.audit {
+		// the removed rules are recorded by the audit.
+		err = p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+			lines, err := p.deleteReturning(ctx, tx, where, args, time.Now().UnixNano())
+			affected = int64(len(lines))
 
-	var value string
+			if err != nil || affected == 0 {
+				if err == nil && p.strict {
+					err = ErrNotFound
+				}
 
-	l := fieldIndex + len(fieldValues)
+				return nil, err
+			}
+
+			return append(changes[:1:1], removedChanges(lines)...), nil
+		})
+	} else {
+		affected, err = p.deleteRows(ctx, changes, p.strict, p.sqlDeleteByArgs+where, args...)
+	}
+
+	return affected, p.opError("RemoveFilteredPolicy", nil, err)
+}
+
+// RemoveFilteredPolicyReturning  remove policy rules that match the filter from the storage,
+// returns the removed rules which start with the ptype, like UpdateFilteredPolicies and PurgeExpired,
+// the rules are selected and removed atomically.
+func (p *Adapter) RemoveFilteredPolicyReturning(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	if err := p.acquire(); err != nil {
+		return nil, p.opError("RemoveFilteredPolicyReturning", nil, err)
+	}
+	defer p.release()
 
-	for idx := 0; idx < 6; idx++ {
-		if fieldIndex <= idx && idx < l {
-			value = fieldValues[idx-fieldIndex]
+	where, args, err := p.genFilteredWhere(ptype, fieldIndex, fieldValues)
+	if err != nil {
+		return nil, p.opError("RemoveFilteredPolicyReturning", nil, err)
+	}
+
+	var lines []*CasbinRule
+
+	changes := []*Change{{Op: OpRemoveFilteredPolicy, Sec: sec, PType: ptype, FieldIndex: fieldIndex, Rule: fieldValues}}
 
-			if value != "" {
-				sqlBuf.WriteString(" AND v")
-				sqlBuf.WriteString(strconv.Itoa(idx))
-				sqlBuf.WriteString("=?")
+	err = p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+		var err error
 
-				args = append(args, value)
+		lines, err = p.deleteReturning(ctx, tx, where, args, time.Now().UnixNano())
+		if err != nil || len(lines) == 0 {
+			if err == nil && p.strict {
+				err = ErrNotFound
 			}
+
+			return nil, err
 		}
+
+		return append(changes[:1:1], removedChanges(lines)...), nil
+	})
+	if err != nil {
+		return nil, p.opError("RemoveFilteredPolicyReturning", nil, err)
 	}
 
-	return p.deleteRows(sqlBuf.String(), args...)
+	rules := make([][]string, 0, len(lines))
+	for _, line := range lines {
+		rules = append(rules, line.toRule())
+	}
+
+	return rules, nil
+}
+
+// deleteReturning  delete the rows which match the where conditions in the transaction,
+// returns the deleted rows. It uses "DELETE ... RETURNING" or "OUTPUT DELETED" if the dialect supports it,
+// otherwise it selects the rows with "FOR UPDATE" and deletes them, now is the time of the removal.
+func (p *Adapter) deleteReturning(ctx context.Context, tx *sqlx.Tx, where string, args []interface{}, now int64) ([]*CasbinRule, error) {
+	head := p.deleteArgs(now)
+
+	if p.sqlDeleteReturning != "" {
+		return p.queryRows(ctx, tx, p.dialect.rebind(p.sqlDeleteReturning+where+p.sqlReturning), append(head, args...)...)
+	}
+
+	query := p.sqlSelectWhere + "p_type=?" + where
+
+	switch p.dialect {
+	case DialectMysql, DialectOracle:
+		query += sqlForUpdate
+	case DialectGeneric, DialectPostgres, DialectCockroach, DialectSqlite3, DialectSqlserver, DialectDuckdb:
+	}
+
+	lines, err := p.queryRows(ctx, tx, p.dialect.rebind(query), append(p.scopeArgs(), args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, p.dialect.rebind(p.sqlDeleteByArgs+where), append(head, args...)...); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
 }
 
 // RemovePolicies  remove policy rules.
-func (p *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) (err error) {
-	args := make([][]interface{}, 0, 8)
+func (p *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	_, err := p.RemovePoliciesAffected(p.ctx, sec, ptype, rules)
 
-	for _, rule := range rules {
-		arg := p.genArgs(ptype, rule)
-		args = append(args, arg)
+	return err
+}
+
+// RemovePoliciesCtx  remove policy rules with context.
+func (p *Adapter) RemovePoliciesCtx(ctx context.Context, sec string, ptype string, rules [][]string) error {
+	_, err := p.RemovePoliciesAffected(ctx, sec, ptype, rules)
+
+	return err
+}
+
+// RemovePoliciesAffected  remove policy rules, returns the count of the removed rules.
+// In the strict mode, the rules are removed in a transaction,
+// it fails with ErrNotFound and removes nothing if any rule is not found.
+func (p *Adapter) RemovePoliciesAffected(ctx context.Context, sec string, ptype string, rules [][]string) (int64, error) {
+	if err := p.acquire(); err != nil {
+		return 0, p.opError("RemovePolicies", nil, err)
+	}
+	defer p.release()
+
+	args, err := p.genArgsList(ptype, rules)
+	if err != nil {
+		return 0, p.opError("RemovePolicies", nil, err)
+	}
+
+	changes := newChanges(OpRemovePolicy, sec, ptype, rules)
+
+	// the strict mode checks the affected rows of every rule.
+	if p.strict {
+		affected, err := p.execTxSQLRows(ctx, changes, p.sqlDeleteRow, p.deleteArgs(time.Now().UnixNano()), args, true)
+
+		return affected, p.opError("RemovePolicies", nil, err)
 	}
 
-	return p.execTxSQLRows(p.sqlDeleteRow, args)
+	var affected int64
+
+	err = p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+		var err error
+
+		affected, err = p.deleteRowsBatch(ctx, tx, args)
+
+		return affectedChanges(changes, affected), err
+	})
+
+	return affected, p.opError("RemovePolicies", nil, err)
 }
 
 // LoadFilteredPolicy  load policy rules that match the filter.
 // filterPtr must be a pointer.
 func (p *Adapter) LoadFilteredPolicy(model model.Model, filterPtr interface{}) error {
+	return p.LoadFilteredPolicyCtx(p.ctx, model, filterPtr)
+}
+
+// LoadFilteredPolicyCtx  load policy rules that match the filter with context.
+// filterPtr must be a pointer.
+func (p *Adapter) LoadFilteredPolicyCtx(ctx context.Context, model model.Model, filterPtr interface{}) error {
+	// LoadPolicyCtx acquires the Adapter itself.
 	if filterPtr == nil {
-		return p.LoadPolicy(model)
+		return p.LoadPolicyCtx(ctx, model)
+	}
+
+	if err := p.acquire(); err != nil {
+		return p.opError("LoadFilteredPolicy", nil, err)
 	}
+	defer p.release()
 
 	filter, ok := filterPtr.(*Filter)
-	if !ok {
-		return errors.New("invalid filter type")
+	if !ok || filter == nil {
+		return p.opError("LoadFilteredPolicy", nil, fmt.Errorf("%w: type %T", ErrInvalidFilter, filterPtr))
 	}
 
-	lines, err := p.selectWhereIn(filter)
+	lines, err := p.selectWhereIn(ctx, filter)
 	if err != nil {
-		return err
+		return p.opError("LoadFilteredPolicy", nil, err)
 	}
 
 	for _, line := range lines {
 		if err = p.loadPolicyLine(line, model); err != nil {
-			return err
+			return p.opError("LoadFilteredPolicy", line.toRule(), err)
 		}
 	}
 
@@ -471,151 +1509,157 @@ func (p *Adapter) IsFiltered() bool {
 	return p.isFiltered
 }
 
+// IsFilteredCtx  returns true if the loaded policy rules has been filtered.
+func (p *Adapter) IsFilteredCtx(ctx context.Context) bool {
+	return p.isFiltered
+}
+
 // UpdatePolicy update a policy rule from storage.
 // This is part of the Auto-Save feature.
 func (p *Adapter) UpdatePolicy(sec, ptype string, oldRule, newPolicy []string) error {
-	oldArg := p.genArgs(ptype, oldRule)
-	newArg := p.genArgs(ptype, newPolicy)
-
-	_, err := p.db.ExecContext(p.ctx, p.sqlUpdateRow, append(newArg, oldArg...)...)
-
-	return err
+	return p.UpdatePolicyCtx(p.ctx, sec, ptype, oldRule, newPolicy)
 }
 
-// UpdatePolicies updates policy rules to storage.
-func (p *Adapter) UpdatePolicies(sec, ptype string, oldRules, newRules [][]string) (err error) {
-	if len(oldRules) != len(newRules) {
-		return errors.New("old rules size not equal to new rules size")
+// UpdatePolicyCtx update a policy rule from storage with context.
+// This is part of the Auto-Save feature.
+func (p *Adapter) UpdatePolicyCtx(ctx context.Context, sec, ptype string, oldRule, newPolicy []string) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("UpdatePolicy", nil, err)
+	}
+	defer p.release()
+
+	oldArg, err := p.genArgs(ptype, oldRule)
+	if err != nil {
+		return p.opError("UpdatePolicy", append([]string{ptype}, oldRule...), err)
 	}
 
-	args := make([][]interface{}, 0, 16)
+	newArg, err := p.genArgs(ptype, newPolicy)
+	if err == nil {
+		changes := []*Change{{Op: OpUpdatePolicy, Sec: sec, PType: ptype, Rule: newPolicy, OldRule: oldRule}}
 
-	for idx := range oldRules {
-		oldArg := p.genArgs(ptype, oldRules[idx])
-		newArg := p.genArgs(ptype, newRules[idx])
-		args = append(args, append(newArg, oldArg...))
+		if p.history {
+			_, err = p.updateHistory(ctx, changes, [][]interface{}{oldArg}, [][]interface{}{newArg}, p.strict)
+		} else {
+			_, err = p.exec(ctx, changes, p.strict, p.sqlUpdateRow, p.updateArgs(newArg, oldArg)...)
+		}
 	}
 
-	return p.execTxSQLRows(p.sqlUpdateRow, args)
+	return p.opError("UpdatePolicy", append([]string{ptype}, newPolicy...), err)
 }
 
-// UpdateFilteredPolicies deletes old rules and adds new rules.
-//
-//nolint:funlen
-func (p *Adapter) UpdateFilteredPolicies(sec, ptype string, newPolicies [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
-	var value string
+// UpdatePolicies updates policy rules to storage.
+func (p *Adapter) UpdatePolicies(sec, ptype string, oldRules, newRules [][]string) error {
+	_, err := p.UpdatePoliciesAffected(p.ctx, sec, ptype, oldRules, newRules)
 
-	var whereBuf bytes.Buffer
-	whereBuf.Grow(32)
+	return err
+}
 
-	l := fieldIndex + len(fieldValues)
+// UpdatePoliciesCtx updates policy rules to storage with context.
+func (p *Adapter) UpdatePoliciesCtx(ctx context.Context, sec, ptype string, oldRules, newRules [][]string) error {
+	_, err := p.UpdatePoliciesAffected(ctx, sec, ptype, oldRules, newRules)
 
-	whereArgs := make([]interface{}, 0, 4)
-	whereArgs = append(whereArgs, ptype)
+	return err
+}
 
-	for idx := 0; idx < 6; idx++ {
-		if fieldIndex <= idx && idx < l {
-			value = fieldValues[idx-fieldIndex]
+// UpdatePoliciesAffected updates policy rules to storage, returns the count of the updated rules.
+// In the strict mode, it fails with ErrNotFound and updates nothing if any old rule is not found.
+func (p *Adapter) UpdatePoliciesAffected(ctx context.Context, sec, ptype string, oldRules, newRules [][]string) (int64, error) {
+	if err := p.acquire(); err != nil {
+		return 0, p.opError("UpdatePolicies", nil, err)
+	}
+	defer p.release()
 
-			if value != "" {
-				whereBuf.WriteString(" AND v")
-				whereBuf.WriteString(strconv.Itoa(idx))
-				whereBuf.WriteString("=?")
+	if len(oldRules) != len(newRules) {
+		return 0, p.opError("UpdatePolicies", nil, fmt.Errorf("%w: old rules %d, new rules %d", ErrRuleCountMismatch, len(oldRules), len(newRules)))
+	}
 
-				whereArgs = append(whereArgs, value)
-			}
-		}
+	oldArgs, err := p.genArgsList(ptype, oldRules)
+	if err != nil {
+		return 0, p.opError("UpdatePolicies", nil, err)
 	}
 
-	var selectBuf bytes.Buffer
-	selectBuf.Grow(64)
-	selectBuf.WriteString(p.sqlSelectWhere)
-	selectBuf.WriteString("p_type=?")
-	selectBuf.Write(whereBuf.Bytes())
+	newArgs, err := p.genArgsList(ptype, newRules)
+	if err != nil {
+		return 0, p.opError("UpdatePolicies", nil, err)
+	}
 
-	var (
-		oldRows []*CasbinRule
-		err     error
-	)
+	args := make([][]interface{}, 0, len(newArgs))
+	changes := newChanges(OpUpdatePolicy, sec, ptype, newRules)
 
-	value = p.db.Rebind(selectBuf.String())
-	oldRows, err = p.selectRows(value, whereArgs...)
-	if err != nil {
-		return nil, err
+	for idx := range newArgs {
+		args = append(args, p.updateArgs(newArgs[idx], oldArgs[idx]))
+		changes[idx].OldRule = oldRules[idx]
 	}
 
-	var deleteBuf bytes.Buffer
-	deleteBuf.Grow(64)
-	deleteBuf.WriteString(p.sqlDeleteByArgs)
-	deleteBuf.Write(whereBuf.Bytes())
+	if p.history {
+		affected, err := p.updateHistory(ctx, changes, oldArgs, newArgs, p.strict)
 
-	var tx *sqlx.Tx
-	tx, err = p.db.BeginTxx(p.ctx, nil)
-	if err != nil {
-		return nil, err
+		return affected, p.opError("UpdatePolicies", nil, err)
 	}
 
-	var (
-		stmt        *sqlx.Stmt
-		oldPolicies [][]string
-		action      string
-	)
-	value = p.db.Rebind(deleteBuf.String())
-	if _, err = tx.ExecContext(p.ctx, value, whereArgs...); err != nil {
-		action = "delete old policies"
-		goto ROLLBACK
+	affected, err := p.execTxSQLRows(ctx, changes, p.sqlUpdateRow, nil, args, p.strict)
+
+	return affected, p.opError("UpdatePolicies", nil, err)
+}
+
+// UpdateFilteredPolicies deletes old rules and adds new rules in a transaction,
+// returns the deleted old rules which start with the ptype.
+func (p *Adapter) UpdateFilteredPolicies(sec, ptype string, newPolicies [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	return p.UpdateFilteredPoliciesCtx(p.ctx, sec, ptype, newPolicies, fieldIndex, fieldValues...)
+}
+
+// UpdateFilteredPoliciesCtx deletes old rules and adds new rules in a transaction with context,
+// returns the deleted old rules which start with the ptype.
+func (p *Adapter) UpdateFilteredPoliciesCtx(ctx context.Context, sec, ptype string, newPolicies [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	if err := p.acquire(); err != nil {
+		return nil, p.opError("UpdateFilteredPolicies", nil, err)
 	}
+	defer p.release()
 
-	stmt, err = tx.PreparexContext(p.ctx, p.sqlInsertRow)
+	args, err := p.genArgsList(ptype, newPolicies)
 	if err != nil {
-		action = "preparex context"
-		goto ROLLBACK
+		return nil, p.opError("UpdateFilteredPolicies", nil, err)
 	}
 
-	for _, policy := range newPolicies {
-		arg := p.genArgs(ptype, policy)
-		if _, err = stmt.ExecContext(p.ctx, arg...); err != nil {
-			action = "stmt exec context"
-			goto ROLLBACK
-		}
+	where, whereArgs, err := p.genFilteredWhere(ptype, fieldIndex, fieldValues)
+	if err != nil {
+		return nil, p.opError("UpdateFilteredPolicies", nil, err)
 	}
 
-	if err = stmt.Close(); err != nil {
-		action = "stmt close"
-		goto ROLLBACK
-	}
+	var oldRows []*CasbinRule
 
-	if err = tx.Commit(); err != nil {
-		action = "commit"
-		goto ROLLBACK
-	}
+	changes := append(
+		[]*Change{{Op: OpRemoveFilteredPolicy, Sec: sec, PType: ptype, FieldIndex: fieldIndex, Rule: fieldValues}},
+		newChanges(OpAddPolicy, sec, ptype, newPolicies)...,
+	)
 
-	oldPolicies = make([][]string, 0, len(oldRows))
-	for _, rule := range oldRows {
-		oldRule := []string{rule.PType, rule.V0, rule.V1, rule.V2, rule.V3, rule.V4, rule.V5}
-		oldPolicy := make([]string, 0, len(oldRule))
-		for _, val := range oldRule {
-			if val == "" {
-				break
-			}
-			oldPolicy = append(oldPolicy, val)
-		}
-		oldPolicies = append(oldPolicies, oldPolicy)
-	}
+	// the old rows are returned by the delete statement or locked by "FOR UPDATE",
+	// so they are exactly the deleted rows. In the history mode the new rows are valid from the time the old rows are closed.
+	err = p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+		var err error
 
-	return oldPolicies, err
+		now := time.Now().UnixNano()
+
+		if oldRows, err = p.deleteReturning(ctx, tx, where, whereArgs, now); err != nil {
+			return nil, err
+		}
 
-ROLLBACK:
+		return append(changes[:len(changes):len(changes)], removedChanges(oldRows)...), p.insertRows(ctx, tx, args, now)
+	})
+	if err != nil {
+		return nil, p.opError("UpdateFilteredPolicies", nil, err)
+	}
 
-	if err1 := tx.Rollback(); err1 != nil {
-		err = fmt.Errorf("%s err: %w, rollback err: %w", action, err, err1)
+	oldPolicies := make([][]string, 0, len(oldRows))
+	for _, rule := range oldRows {
+		oldPolicies = append(oldPolicies, rule.toRule())
 	}
 
-	return nil, err
+	return oldPolicies, nil
 }
 
 // loadPolicyLine  load a policy line to model.
-func (Adapter) loadPolicyLine(line *CasbinRule, model model.Model) error {
+func (*Adapter) loadPolicyLine(line *CasbinRule, model model.Model) error {
 	if line == nil {
 		return nil
 	}
@@ -636,8 +1680,93 @@ func (Adapter) loadPolicyLine(line *CasbinRule, model model.Model) error {
 	return persist.LoadPolicyLine(lineBuf.String(), model)
 }
 
+// isRuleColumn  check the column is one of the rule columns,
+// the tenant_id column is included in the tenant mode, so the unique indexes can be scoped to the tenants.
+func (p *Adapter) isRuleColumn(col string) bool {
+	switch col {
+	case "p_type", "v0", "v1", "v2", "v3", "v4", "v5":
+		return true
+	case "tenant_id":
+		return p.tenantColumn
+	}
+
+	return false
+}
+
+// ruleColumnLength  get the max characters of the rule column.
+func ruleColumnLength(col string) int {
+	switch col {
+	case "p_type":
+		return 32
+	case "tenant_id":
+		return maxTenantIDLength
+	}
+
+	return 255
+}
+
+// isIdentifier  check the name only contains letters, digits and underscores.
+func isIdentifier(name string) bool {
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+// genFilteredWhere  generate the where conditions which follow "p_type=?" and the args from the filter,
+// the empty field values match all values.
+// It returns ErrInvalidFieldIndex if the field values are out of the columns v0 ~ v5,
+// and ErrWipeRefused if the wipe guard is enabled and the filter matches the whole ptype.
+func (p *Adapter) genFilteredWhere(ptype string, fieldIndex int, fieldValues []string) (string, []interface{}, error) {
+	// the field values are in the columns v0 ~ v5, which follow p_type.
+	if fieldIndex < 0 || fieldIndex > maxParamLength-2 || fieldIndex+len(fieldValues) > maxParamLength-1 {
+		return "", nil, fmt.Errorf("%w: field index %d, field values %d", ErrInvalidFieldIndex, fieldIndex, len(fieldValues))
+	}
+
+	var whereBuf strings.Builder
+
+	whereBuf.Grow(32)
+
+	args := make([]interface{}, 0, 4)
+	args = append(args, ptype)
+
+	for idx, value := range fieldValues {
+		if value != "" {
+			whereBuf.WriteString(" AND v")
+			whereBuf.WriteString(strconv.Itoa(fieldIndex + idx))
+			whereBuf.WriteString("=?")
+
+			args = append(args, value)
+		}
+	}
+
+	if whereBuf.Len() == 0 && p.wipeGuard && !p.isWipeAllowed(ptype) {
+		return "", nil, fmt.Errorf("%w: ptype %s", ErrWipeRefused, ptype)
+	}
+
+	return whereBuf.String(), args, nil
+}
+
+// isWipeAllowed  check the ptype is allowed to be wiped by the wipe guard.
+func (p *Adapter) isWipeAllowed(ptype string) bool {
+	for _, allowed := range p.wipeAllowed {
+		if allowed == ptype {
+			return true
+		}
+	}
+
+	return false
+}
+
 // genArgs  generate args from ptype and rule.
-func (Adapter) genArgs(ptype string, rule []string) []interface{} {
+func (*Adapter) genArgs(ptype string, rule []string) ([]interface{}, error) {
+	if len(rule) >= maxParamLength {
+		return nil, ErrRuleTooLong
+	}
+
 	args := make([]interface{}, 0, maxParamLength)
 	args = append(args, ptype)
 
@@ -649,5 +1778,47 @@ func (Adapter) genArgs(ptype string, rule []string) []interface{} {
 		args = append(args, "")
 	}
 
-	return args
+	return args, nil
+}
+
+// genArgsList  generate args from ptype and rules.
+func (p *Adapter) genArgsList(ptype string, rules [][]string) ([][]interface{}, error) {
+	args := make([][]interface{}, 0, len(rules))
+
+	for _, rule := range rules {
+		arg, err := p.genArgs(ptype, rule)
+		if err != nil {
+			return nil, &OpError{Rule: append([]string{ptype}, rule...), Err: err}
+		}
+
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+// argsToRule  convert the args of a row to the rule which starts with the ptype,
+// the trailing empty values are removed.
+func argsToRule(args []interface{}) []string {
+	if len(args) > maxParamLength {
+		args = args[:maxParamLength]
+	}
+
+	rule := make([]string, 0, len(args))
+	for _, arg := range args {
+		value, _ := arg.(string)
+		rule = append(rule, value)
+	}
+
+	for len(rule) > 1 && rule[len(rule)-1] == "" {
+		rule = rule[:len(rule)-1]
+	}
+
+	return rule
+}
+
+// toRule  convert the casbin rule model to the rule which starts with the ptype,
+// the trailing empty values are removed.
+func (r *CasbinRule) toRule() []string {
+	return argsToRule([]interface{}{r.PType, r.V0, r.V1, r.V2, r.V3, r.V4, r.V5})
 }
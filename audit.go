@@ -0,0 +1,233 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// auditTableSuffix  the audit table is named "<table>_audit".
+const auditTableSuffix = "_audit"
+
+// AuditEntry  an audit record of a change of the policy rules.
+// For AddPolicy, Rule is the added rule; for RemovePolicy, Rule is the removed rule;
+// for RemoveFilteredPolicy, Rule is the filter from FieldIndex; for UpdatePolicy, OldRule is the rule before the update.
+// RemoveFilteredPolicy is followed by a RemovePolicy entry for every removed rule,
+// and SavePolicy is followed by the RemovePolicy and AddPolicy entries of the rules it removed and added.
+type AuditEntry struct {
+	Change
+
+	RequestID string
+}
+
+// AuditQuery  the conditions to list the audit entries, the zero values are ignored.
+type AuditQuery struct {
+	PType string
+	// Rule  the rule values from v0, the non-empty values must match the rule or the old rule of the entry.
+	Rule  []string
+	Actor string
+	// Since and Until  the time range [Since, Until) of the entries.
+	Since time.Time
+	Until time.Time
+	// Limit  the max count of the entries, 0 means no limit.
+	Limit int
+}
+
+// auditRow  the row of the audit table.
+type auditRow struct {
+	changeRow
+
+	RequestID sql.NullString `db:"request_id"`
+}
+
+// enableAudit  create the audit table if it does not exist,
+// and record the changes in the transaction of every write.
+func (p *Adapter) enableAudit(ctx context.Context) error {
+	if p.sqlInsertAudit != "" {
+		return nil
+	}
+
+	auditTable := p.tableName + auditTableSuffix
+
+	sqlCreateTable := fmt.Sprintf(sqlCreateAuditTable, auditTable, "VARCHAR")
+
+	switch p.dialect {
+	case DialectOracle:
+		sqlCreateTable = fmt.Sprintf(sqlCreateAuditTableOracle, auditTable)
+	case DialectSqlserver:
+		sqlCreateTable = fmt.Sprintf(sqlCreateAuditTable, auditTable, "NVARCHAR")
+	case DialectGeneric, DialectPostgres, DialectCockroach, DialectMysql, DialectSqlite3, DialectDuckdb:
+	}
+
+	err := p.ensureTable(ctx, auditTable, sqlCreateTable,
+		fmt.Sprintf(sqlCreateIndex, "", "idx_"+auditTable+"_created_at", auditTable, "created_at"),
+		fmt.Sprintf(sqlCreateIndex, "", "idx_"+auditTable+"_actor", auditTable, "actor"),
+	)
+	if err != nil {
+		return err
+	}
+
+	p.sqlInsertAudit = p.dialect.rebind(fmt.Sprintf(sqlInsertAudit, auditTable))
+	p.sqlSelectAudit = fmt.Sprintf(sqlSelectAudit, auditTable)
+	p.writeHooks = append(p.writeHooks, p.insertAudit)
+
+	return nil
+}
+
+// insertAudit  the write hook to record the changes with the actor and the request ID in the transaction.
+func (p *Adapter) insertAudit(ctx context.Context, tx *sqlx.Tx, changes []*Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	stmt, err := p.prepareTx(ctx, tx, p.sqlInsertAudit)
+	if err != nil {
+		return err
+	}
+
+	actor := ActorFromContext(ctx)
+	requestID := RequestIDFromContext(ctx)
+	createdAt := time.Now().UnixNano()
+
+	for idx, change := range changes {
+		args := make([]interface{}, 0, 21)
+		args = changeArgs(args, idx, change)
+		args = append(args, actor, requestID, tenantArg(change.Tenant), createdAt)
+
+		if _, err = stmt.ExecContext(ctx, args...); err != nil {
+			_ = stmt.Close()
+
+			return err
+		}
+	}
+
+	return stmt.Close()
+}
+
+// ListAudit  list the audit entries which match the query, in the order of the time.
+// The Adapter must be created with WithAudit. In the tenant mode, only the entries of the tenant of the Adapter are listed.
+func (p *Adapter) ListAudit(ctx context.Context, query AuditQuery) ([]*AuditEntry, error) {
+	if err := p.acquire(); err != nil {
+		return nil, p.opError("ListAudit", nil, err)
+	}
+	defer p.release()
+
+	if p.sqlSelectAudit == "" {
+		return nil, p.opError("ListAudit", nil, ErrAuditDisabled)
+	}
+
+	if len(query.Rule) >= maxParamLength {
+		return nil, p.opError("ListAudit", query.Rule, ErrRuleTooLong)
+	}
+
+	var sqlBuf bytes.Buffer
+
+	sqlBuf.Grow(256)
+	sqlBuf.WriteString(p.tenanted(p.sqlSelectAudit))
+
+	args := append(make([]interface{}, 0, 16), p.scopeArgs()...)
+
+	if query.PType != "" {
+		sqlBuf.WriteString(" AND p_type=?")
+		args = append(args, query.PType)
+	}
+
+	if query.Actor != "" {
+		sqlBuf.WriteString(" AND actor=?")
+		args = append(args, query.Actor)
+	}
+
+	if !query.Since.IsZero() {
+		sqlBuf.WriteString(" AND created_at>=?")
+		args = append(args, query.Since.UnixNano())
+	}
+
+	if !query.Until.IsZero() {
+		sqlBuf.WriteString(" AND created_at<?")
+		args = append(args, query.Until.UnixNano())
+	}
+
+	// the rule matches the new rule or the old rule.
+	if cond, condArgs := ruleCondition("v", query.Rule); cond != "" {
+		oldCond, oldArgs := ruleCondition("o", query.Rule)
+
+		sqlBuf.WriteString(" AND ((" + cond + ") OR (" + oldCond + "))")
+
+		args = append(args, condArgs...)
+		args = append(args, oldArgs...)
+	}
+
+	sqlBuf.WriteString(sqlOrderAudit)
+
+	if query.Limit > 0 {
+		switch p.dialect {
+		case DialectSqlserver, DialectOracle:
+			fmt.Fprintf(&sqlBuf, sqlFetchFirst, query.Limit)
+		case DialectGeneric, DialectPostgres, DialectCockroach, DialectMysql, DialectSqlite3, DialectDuckdb:
+			fmt.Fprintf(&sqlBuf, sqlLimit, query.Limit)
+		}
+	}
+
+	var rows []*auditRow
+
+	err := p.retry.do(ctx, p.dialect, func() error {
+		rows = make([]*auditRow, 0, 64)
+
+		return p.db.SelectContext(ctx, &rows, p.dialect.rebind(sqlBuf.String()), args...)
+	})
+	if err != nil {
+		return nil, p.opError("ListAudit", nil, err)
+	}
+
+	entries := make([]*AuditEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, &AuditEntry{Change: *row.toChange(), RequestID: row.RequestID.String})
+	}
+
+	return entries, nil
+}
+
+// ruleCondition  generate the condition which matches the non-empty values of the rule
+// on the columns with the prefix, such as "v0=? AND v2=?".
+func ruleCondition(prefix string, rule []string) (string, []interface{}) {
+	var sqlBuf bytes.Buffer
+
+	args := make([]interface{}, 0, len(rule))
+
+	for idx, value := range rule {
+		if value == "" {
+			continue
+		}
+
+		if len(args) > 0 {
+			sqlBuf.WriteString(" AND ")
+		}
+
+		sqlBuf.WriteString(prefix)
+		sqlBuf.WriteString(strconv.Itoa(idx))
+		sqlBuf.WriteString("=?")
+
+		args = append(args, value)
+	}
+
+	return sqlBuf.String(), args
+}
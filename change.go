@@ -0,0 +1,172 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/casbin/casbin/v3/model"
+)
+
+// the operations of Change.
+const (
+	OpAddPolicy            = "AddPolicy"
+	OpRemovePolicy         = "RemovePolicy"
+	OpRemoveFilteredPolicy = "RemoveFilteredPolicy"
+	OpUpdatePolicy         = "UpdatePolicy"
+	OpSavePolicy           = "SavePolicy"
+)
+
+// Change  a change of the policy rules made by a write of the Adapter.
+type Change struct {
+	// Seq  the sequence number of the transaction, the changes of one transaction have the same Seq.
+	Seq int64 `json:"seq,omitempty"`
+	// Index  the index of the change in the transaction.
+	Index int `json:"index"`
+
+	Op    string `json:"op"`
+	Sec   string `json:"sec,omitempty"`
+	PType string `json:"ptype,omitempty"`
+
+	// FieldIndex  the field index of RemoveFilteredPolicy, Rule holds the field values.
+	FieldIndex int `json:"field_index,omitempty"`
+	// Rule  the added or removed rule, or the new rule of UpdatePolicy.
+	Rule []string `json:"rule,omitempty"`
+	// OldRule  the old rule of UpdatePolicy.
+	OldRule []string `json:"old_rule,omitempty"`
+
+	Actor string `json:"actor,omitempty"`
+	// Tenant  the tenant id of the Adapter which made the change, it is empty for the Adapter itself.
+	Tenant    string    `json:"tenant,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// auditOnly  the change is recorded by the audit only, such as the rules removed by a filter,
+	// it is not recorded in the change log or notified, because the peers apply the changes incrementally.
+	auditOnly bool
+}
+
+// newChanges  generate one change of op for every rule.
+func newChanges(op, sec, ptype string, rules [][]string) []*Change {
+	changes := make([]*Change, 0, len(rules))
+
+	for _, rule := range rules {
+		changes = append(changes, &Change{Op: op, Sec: sec, PType: ptype, Rule: rule})
+	}
+
+	return changes
+}
+
+// newAuditChanges  generate one audit only change of op for every rule which starts with the ptype.
+func newAuditChanges(op string, rules [][]string) []*Change {
+	changes := make([]*Change, 0, len(rules))
+
+	for _, rule := range rules {
+		changes = append(changes, &Change{Op: op, Sec: ptypeSec(rule[0]), PType: rule[0], Rule: rule[1:], auditOnly: true})
+	}
+
+	return changes
+}
+
+// removedChanges  generate the audit only changes of the removed rows.
+func removedChanges(lines []*CasbinRule) []*Change {
+	rules := make([][]string, 0, len(lines))
+	for _, line := range lines {
+		rules = append(rules, line.toRule())
+	}
+
+	return newAuditChanges(OpRemovePolicy, rules)
+}
+
+// appliedChanges  get the changes which are applied incrementally by the peers, without the audit only changes.
+func appliedChanges(changes []*Change) []*Change {
+	applied := changes[:0:0]
+
+	for _, change := range changes {
+		if !change.auditOnly {
+			applied = append(applied, change)
+		}
+	}
+
+	return applied
+}
+
+// ChangeEnforcer  the enforcer methods used by ApplyChange, *casbin.Enforcer implements it.
+type ChangeEnforcer interface {
+	GetModel() model.Model
+	BuildIncrementalRoleLinks(op model.PolicyOp, ptype string, rules [][]string) error
+	LoadPolicy() error
+}
+
+// ApplyChange  apply the change to the in-memory model of the enforcer,
+// it does not write the storage, so the change is not written again by the enforcer of the other instance.
+// A SavePolicy change reloads the whole policy.
+//
+// It is not safe to call ApplyChange concurrently with the other methods of the enforcer.
+func ApplyChange(e ChangeEnforcer, c Change) error {
+	m := e.GetModel()
+
+	switch c.Op {
+	case OpAddPolicy:
+		has, err := m.HasPolicy(c.Sec, c.PType, c.Rule)
+		if has || err != nil {
+			return err
+		}
+
+		if err = m.AddPolicy(c.Sec, c.PType, c.Rule); err != nil {
+			return err
+		}
+
+		return buildRoleLinks(e, c.Sec, model.PolicyAdd, c.PType, [][]string{c.Rule})
+	case OpRemovePolicy:
+		removed, err := m.RemovePolicy(c.Sec, c.PType, c.Rule)
+		if !removed || err != nil {
+			return err
+		}
+
+		return buildRoleLinks(e, c.Sec, model.PolicyRemove, c.PType, [][]string{c.Rule})
+	case OpRemoveFilteredPolicy:
+		removed, rules, err := m.RemoveFilteredPolicy(c.Sec, c.PType, c.FieldIndex, c.Rule...)
+		if !removed || err != nil {
+			return err
+		}
+
+		return buildRoleLinks(e, c.Sec, model.PolicyRemove, c.PType, rules)
+	case OpUpdatePolicy:
+		updated, err := m.UpdatePolicy(c.Sec, c.PType, c.OldRule, c.Rule)
+		if !updated || err != nil {
+			return err
+		}
+
+		if err = buildRoleLinks(e, c.Sec, model.PolicyRemove, c.PType, [][]string{c.OldRule}); err != nil {
+			return err
+		}
+
+		return buildRoleLinks(e, c.Sec, model.PolicyAdd, c.PType, [][]string{c.Rule})
+	case OpSavePolicy:
+		return e.LoadPolicy()
+	}
+
+	return fmt.Errorf("sqlxadapter: unknown change op %q", c.Op)
+}
+
+// buildRoleLinks  build the role links of the grouping rules incrementally.
+func buildRoleLinks(e ChangeEnforcer, sec string, op model.PolicyOp, ptype string, rules [][]string) error {
+	if sec != "g" {
+		return nil
+	}
+
+	return e.BuildIncrementalRoleLinks(op, ptype, rules)
+}
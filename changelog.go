@@ -0,0 +1,257 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// changelogTableSuffix  the change log table is named "<table>_changelog".
+const changelogTableSuffix = "_changelog"
+
+// changeRow  the row of the change log table and the audit table, the columns may be NULL.
+type changeRow struct {
+	Seq        int64          `db:"seq"`
+	Idx        int            `db:"idx"`
+	Op         string         `db:"op"`
+	Sec        sql.NullString `db:"sec"`
+	PType      sql.NullString `db:"p_type"`
+	FieldIndex sql.NullInt64  `db:"field_index"`
+	V0         sql.NullString `db:"v0"`
+	V1         sql.NullString `db:"v1"`
+	V2         sql.NullString `db:"v2"`
+	V3         sql.NullString `db:"v3"`
+	V4         sql.NullString `db:"v4"`
+	V5         sql.NullString `db:"v5"`
+	O0         sql.NullString `db:"o0"`
+	O1         sql.NullString `db:"o1"`
+	O2         sql.NullString `db:"o2"`
+	O3         sql.NullString `db:"o3"`
+	O4         sql.NullString `db:"o4"`
+	O5         sql.NullString `db:"o5"`
+	Actor      sql.NullString `db:"actor"`
+	TenantID   sql.NullString `db:"tenant_id"`
+	CreatedAt  int64          `db:"created_at"`
+}
+
+// toChange  convert the row to Change, the trailing empty values of the rules are trimmed.
+func (r *changeRow) toChange() *Change {
+	return &Change{
+		Seq:        r.Seq,
+		Index:      r.Idx,
+		Op:         r.Op,
+		Sec:        r.Sec.String,
+		PType:      r.PType.String,
+		FieldIndex: int(r.FieldIndex.Int64),
+		Rule:       trimRule(r.V0, r.V1, r.V2, r.V3, r.V4, r.V5),
+		OldRule:    trimRule(r.O0, r.O1, r.O2, r.O3, r.O4, r.O5),
+		Actor:      r.Actor.String,
+		Tenant:     r.TenantID.String,
+		CreatedAt:  time.Unix(0, r.CreatedAt),
+	}
+}
+
+// trimRule  convert the values to a rule, the trailing empty values are trimmed.
+func trimRule(values ...sql.NullString) []string {
+	end := len(values)
+	for end > 0 && values[end-1].String == "" {
+		end--
+	}
+
+	if end == 0 {
+		return nil
+	}
+
+	rule := make([]string, 0, end)
+	for _, val := range values[:end] {
+		rule = append(rule, val.String)
+	}
+
+	return rule
+}
+
+// changeArgs  append the index and the values of the change to args, the rules are padded to 6 values.
+func changeArgs(args []interface{}, idx int, change *Change) []interface{} {
+	args = append(args, idx, change.Op, change.Sec, change.PType, change.FieldIndex)
+	args = padRule(args, change.Rule)
+
+	return padRule(args, change.OldRule)
+}
+
+// padRule  append the rule values to args, padded to 6 values.
+func padRule(args []interface{}, rule []string) []interface{} {
+	for idx := 0; idx < maxParamLength-1; idx++ {
+		var val string
+		if idx < len(rule) {
+			val = rule[idx]
+		}
+
+		args = append(args, val)
+	}
+
+	return args
+}
+
+// initOrigin  generate a random id of the Adapter instance if it is not generated,
+// the watchers skip the changes made by the same instance.
+func (p *Adapter) initOrigin() error {
+	if p.origin != "" {
+		return nil
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+
+	p.origin = hex.EncodeToString(buf)
+
+	return nil
+}
+
+// enableChangelog  create the version table and the change log table if they do not exist,
+// and record the changes in the transaction of every write.
+// The version is bumped before the changes are recorded, so the lock of the version row
+// orders the writers, and the changes of a transaction are recorded with the bumped version.
+func (p *Adapter) enableChangelog(ctx context.Context) error {
+	if p.sqlInsertChangelog != "" {
+		return nil
+	}
+
+	if err := p.enableVersion(ctx); err != nil {
+		return err
+	}
+
+	changelogTable := p.tableName + changelogTableSuffix
+
+	sqlCreateTable := fmt.Sprintf(sqlCreateChangelogTable, changelogTable, "VARCHAR")
+
+	switch p.dialect {
+	case DialectOracle:
+		sqlCreateTable = fmt.Sprintf(sqlCreateChangelogTableOracle, changelogTable)
+	case DialectSqlserver:
+		sqlCreateTable = fmt.Sprintf(sqlCreateChangelogTable, changelogTable, "NVARCHAR")
+	case DialectGeneric, DialectPostgres, DialectCockroach, DialectMysql, DialectSqlite3, DialectDuckdb:
+	}
+
+	if err := p.ensureTable(ctx, changelogTable, sqlCreateTable); err != nil {
+		return err
+	}
+
+	if err := p.initOrigin(); err != nil {
+		return err
+	}
+
+	p.sqlInsertChangelog = p.dialect.rebind(fmt.Sprintf(sqlInsertChangelog, changelogTable))
+	p.sqlSelectChangelog = fmt.Sprintf(sqlSelectChangelog, changelogTable)
+	p.sqlPurgeChangelog = fmt.Sprintf(sqlPurgeChangelog, changelogTable)
+	p.writeHooks = append(p.writeHooks, p.insertChangelog)
+
+	return nil
+}
+
+// insertChangelog  the write hook to record the changes with the bumped version in the transaction.
+func (p *Adapter) insertChangelog(ctx context.Context, tx *sqlx.Tx, changes []*Change) error {
+	if changes = appliedChanges(changes); len(changes) == 0 {
+		return nil
+	}
+
+	var seq int64
+	if err := tx.GetContext(ctx, &seq, p.sqlSelectVersion); err != nil {
+		return err
+	}
+
+	stmt, err := p.prepareTx(ctx, tx, p.sqlInsertChangelog)
+	if err != nil {
+		return err
+	}
+
+	actor := ActorFromContext(ctx)
+	createdAt := time.Now().UnixNano()
+
+	for idx, change := range changes {
+		args := make([]interface{}, 0, 22)
+		args = append(args, seq)
+		args = changeArgs(args, idx, change)
+		args = append(args, actor, p.origin, tenantArg(change.Tenant), createdAt)
+
+		if _, err = stmt.ExecContext(ctx, args...); err != nil {
+			_ = stmt.Close()
+
+			return err
+		}
+	}
+
+	return stmt.Close()
+}
+
+// selectChangelog  select the changes made by the other instances, which seq is in (from, to].
+// In the tenant mode, only the changes of the tenant of the Adapter are selected.
+func (p *Adapter) selectChangelog(ctx context.Context, from, to int64) ([]*Change, error) {
+	rows := make([]*changeRow, 0, 16)
+
+	query := p.dialect.rebind(p.tenanted(p.sqlSelectChangelog))
+
+	if err := p.db.SelectContext(ctx, &rows, query, append(p.scopeArgs(), from, to, p.origin)...); err != nil {
+		return nil, err
+	}
+
+	changes := make([]*Change, 0, len(rows))
+	for _, row := range rows {
+		changes = append(changes, row.toChange())
+	}
+
+	return changes, nil
+}
+
+// PurgeChangelog  delete the changes which were recorded before olderThan ago, returns the count of the deleted changes.
+// It requires the Adapter to be created with WithChangelog. In the tenant mode, only the changes of the tenant are deleted.
+// A ChangelogWatcher which has not polled the deleted changes misses them,
+// so olderThan should be much longer than the poll interval.
+func (p *Adapter) PurgeChangelog(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if err := p.acquire(); err != nil {
+		return 0, p.opError("PurgeChangelog", nil, err)
+	}
+	defer p.release()
+
+	if !p.changelog {
+		return 0, p.opError("PurgeChangelog", nil, ErrChangelogDisabled)
+	}
+
+	query := p.dialect.rebind(p.tenanted(p.sqlPurgeChangelog))
+
+	var affected int64
+
+	// the purge does not change the policy, so it does not bump the version or run the other write hooks.
+	err := p.retry.do(ctx, p.dialect, func() error {
+		result, err := p.db.ExecContext(ctx, query, append(p.scopeArgs(), time.Now().Add(-olderThan).UnixNano())...)
+		if err != nil {
+			return err
+		}
+
+		affected, err = result.RowsAffected()
+
+		return err
+	})
+
+	return affected, p.opError("PurgeChangelog", nil, err)
+}
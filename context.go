@@ -0,0 +1,49 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import "context"
+
+// actorKey  the context key of the actor.
+type actorKey struct{}
+
+// WithActor  returns a copy of ctx which carries the actor of the writes,
+// the actor is recorded in the change log by the Ctx methods of the Adapter.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext  returns the actor carried by ctx, or "" if there is none.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+
+	return actor
+}
+
+// requestIDKey  the context key of the request ID.
+type requestIDKey struct{}
+
+// WithRequestID  returns a copy of ctx which carries the request ID of the writes,
+// the request ID is recorded in the audit table by the Ctx methods of the Adapter.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext  returns the request ID carried by ctx, or "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+
+	return requestID
+}
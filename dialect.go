@@ -0,0 +1,330 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect  the SQL dialect of the connected database.
+type Dialect string
+
+// The dialects supported by the Adapter,
+// DialectGeneric uses the general SQL with '?' bindvars,
+// DialectCockroach uses the PostgreSQL SQL and retries the serialization errors.
+const (
+	DialectGeneric   Dialect = "generic"
+	DialectMysql     Dialect = "mysql"
+	DialectPostgres  Dialect = "postgres"
+	DialectCockroach Dialect = "cockroach"
+	DialectSqlite3   Dialect = "sqlite3"
+	DialectSqlserver Dialect = "sqlserver"
+	DialectOracle    Dialect = "oracle"
+	DialectDuckdb    Dialect = "duckdb"
+)
+
+// isValid  check the dialect is one of the supported dialects.
+func (d Dialect) isValid() bool {
+	switch d {
+	case DialectGeneric, DialectMysql, DialectPostgres, DialectCockroach, DialectSqlite3, DialectSqlserver, DialectOracle, DialectDuckdb:
+		return true
+	}
+
+	return false
+}
+
+// detectDialect  detect the dialect by the driver name,
+// if it is unknown, detect by the driver type and then by probing the server version.
+func detectDialect(ctx context.Context, db *sqlx.DB) (Dialect, error) {
+	driverName := db.DriverName()
+	if isUnsupportedDriver(driverName) {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedDriver, driverName)
+	}
+
+	d := dialectByDriverName(driverName)
+	if d == DialectGeneric {
+		pkgPath := driverPkgPath(db.Driver())
+		if isUnsupportedDriver(pkgPath) {
+			return "", fmt.Errorf("%w: %s", ErrUnsupportedDriver, pkgPath)
+		}
+
+		d = dialectByDriverPkgPath(pkgPath)
+	}
+
+	switch d {
+	case DialectGeneric:
+		return dialectByServerVersion(ctx, db), nil
+	case DialectPostgres:
+		// CockroachDB is connected by the PostgreSQL drivers.
+		if isCockroach(ctx, db) {
+			return DialectCockroach, nil
+		}
+	case DialectMysql, DialectCockroach, DialectSqlite3, DialectSqlserver, DialectOracle, DialectDuckdb:
+	}
+
+	return d, nil
+}
+
+// isCockroach  check the PostgreSQL compatible server is CockroachDB.
+func isCockroach(ctx context.Context, db *sqlx.DB) bool {
+	var version string
+	if err := db.GetContext(ctx, &version, "SELECT version()"); err != nil {
+		return false
+	}
+
+	return strings.Contains(version, "CockroachDB")
+}
+
+// dialectByDriverName  get the dialect by the sqlx driver name.
+func dialectByDriverName(driverName string) Dialect {
+	switch driverName {
+	case "postgres", "pgx", "pgx/v4", "pgx/v5", "pq-timeouts", "cloudsql-postgres", "nrpostgres":
+		return DialectPostgres
+	case "cockroach":
+		return DialectCockroach
+	case "mysql", "nrmysql", "cloudsql-mysql":
+		return DialectMysql
+	case "sqlite", "sqlite3", "libsql", "nrsqlite3":
+		return DialectSqlite3
+	case "sqlserver", "azuresql", "mssql", "nrmssql":
+		return DialectSqlserver
+	case "godror", "oci8", "ora", "goracle", "oracle":
+		return DialectOracle
+	case "duckdb":
+		return DialectDuckdb
+	}
+
+	return DialectGeneric
+}
+
+// driverPkgPath  get the package path of the driver type, such as "github.com/lib/pq".
+func driverPkgPath(d driver.Driver) string {
+	if d == nil {
+		return ""
+	}
+
+	t := reflect.TypeOf(d)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.PkgPath()
+}
+
+// dialectByDriverPkgPath  get the dialect by the package path of the driver type,
+// it works when the driver is registered with a custom name.
+func dialectByDriverPkgPath(pkgPath string) Dialect {
+	for _, item := range [...]struct {
+		prefix  string
+		dialect Dialect
+	}{
+		{"github.com/lib/pq", DialectPostgres},
+		{"github.com/jackc/pgx", DialectPostgres},
+		{"github.com/go-sql-driver/mysql", DialectMysql},
+		{"github.com/mattn/go-sqlite3", DialectSqlite3},
+		{"modernc.org/sqlite", DialectSqlite3},
+		{"github.com/glebarez/go-sqlite", DialectSqlite3},
+		{"github.com/ncruces/go-sqlite3", DialectSqlite3},
+		{"github.com/tursodatabase/libsql-client-go", DialectSqlite3},
+		{"github.com/tursodatabase/go-libsql", DialectSqlite3},
+		{"github.com/microsoft/go-mssqldb", DialectSqlserver},
+		{"github.com/denisenkom/go-mssqldb", DialectSqlserver},
+		{"github.com/godror/godror", DialectOracle},
+		{"github.com/mattn/go-oci8", DialectOracle},
+		{"github.com/sijms/go-ora", DialectOracle},
+		{"github.com/marcboeker/go-duckdb", DialectDuckdb},
+		{"github.com/duckdb/duckdb-go", DialectDuckdb},
+	} {
+		if strings.HasPrefix(pkgPath, item.prefix) {
+			return item.dialect
+		}
+	}
+
+	return DialectGeneric
+}
+
+// isUnsupportedDriver  check the driver name or the driver package path is known to be unsupported,
+// such databases can not run the SQL of any dialect.
+func isUnsupportedDriver(name string) bool {
+	for _, unsupported := range [...]string{
+		"clickhouse",
+		"github.com/ClickHouse/clickhouse-go",
+	} {
+		if name == unsupported || strings.HasPrefix(name, unsupported+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dialectByServerVersion  get the dialect by probing the server version,
+// it is used when the driver is wrapped or unknown, the probe errors are ignored.
+// The version is matched case-insensitively, such as "mariadb.org binary distribution",
+// the probes without a keyword must return a version number.
+func dialectByServerVersion(ctx context.Context, db *sqlx.DB) Dialect {
+	for _, probe := range [...]struct {
+		query    string
+		contains string
+		dialect  Dialect
+	}{
+		{"SELECT sqlite_version()", "", DialectSqlite3},
+		{"SELECT library_version FROM pragma_version()", "", DialectDuckdb},
+		{"SELECT version()", "PostgreSQL", DialectPostgres},
+		{"SELECT version()", "CockroachDB", DialectCockroach},
+		{"SELECT @@version_comment", "MySQL", DialectMysql},
+		{"SELECT @@version_comment", "MariaDB", DialectMysql},
+		{"SELECT @@VERSION", "Microsoft SQL Server", DialectSqlserver},
+		{"SELECT banner FROM v$version", "Oracle", DialectOracle},
+	} {
+		var version string
+		if err := db.GetContext(ctx, &version, probe.query); err != nil {
+			continue
+		}
+
+		if probe.contains == "" {
+			if isVersionNumber(version) {
+				return probe.dialect
+			}
+
+			continue
+		}
+
+		if strings.Contains(strings.ToLower(version), strings.ToLower(probe.contains)) {
+			return probe.dialect
+		}
+	}
+
+	return DialectGeneric
+}
+
+// isVersionNumber  check the version is a number such as "3.45.1" or "v1.1.3".
+func isVersionNumber(version string) bool {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".")
+	if len(parts) < 2 {
+		return false
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return false
+		}
+
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// rebind  transform the '?' bindvars in the query to the dialect bindvars,
+// PostgreSQL uses "$1", SQLServer uses "@p1", Oracle uses ":1".
+func (d Dialect) rebind(query string) string {
+	var prefix string
+
+	switch d {
+	case DialectPostgres, DialectCockroach:
+		prefix = "$"
+	case DialectSqlserver:
+		prefix = "@p"
+	case DialectOracle:
+		prefix = ":"
+	default:
+		return query
+	}
+
+	var sqlBuf strings.Builder
+
+	sqlBuf.Grow(len(query) + 32)
+
+	n := 0
+
+	for idx := 0; idx < len(query); idx++ {
+		if query[idx] != '?' {
+			sqlBuf.WriteByte(query[idx])
+			continue
+		}
+
+		n++
+
+		sqlBuf.WriteString(prefix)
+		sqlBuf.WriteString(strconv.Itoa(n))
+	}
+
+	return sqlBuf.String()
+}
+
+// maxBatchRows  get the max rows of a multi-row statement which has rowParams bind parameters in every row,
+// limited by the bind parameters of the dialect, PostgreSQL and MySQL allow 65535 parameters,
+// SQLServer allows 2100 parameters and 1000 rows, SQLite3 allows 999 parameters before 3.32.0.
+// Oracle and the generic dialect exec the rows one by one.
+func (d Dialect) maxBatchRows(rowParams int) int {
+	var maxParams int
+
+	switch d {
+	case DialectPostgres, DialectCockroach, DialectMysql, DialectDuckdb:
+		maxParams = 65535
+	case DialectSqlserver:
+		maxParams = 2099
+	case DialectSqlite3:
+		maxParams = 999
+	case DialectOracle, DialectGeneric:
+	}
+
+	if rows := maxParams / rowParams; rows > 1 {
+		return rows
+	}
+
+	return 1
+}
+
+// maxBatchBytes  get the max estimated bytes of the args of a multi-row statement, 0 means it is not limited.
+// MySQL rejects the packets longer than max_allowed_packet, which is 4MB by default before 8.0,
+// so the batches are kept below it with a margin for the statement itself.
+func (d Dialect) maxBatchBytes() int {
+	switch d {
+	case DialectMysql:
+		return 3 << 20
+	case DialectGeneric, DialectPostgres, DialectCockroach, DialectSqlite3, DialectSqlserver, DialectOracle, DialectDuckdb:
+	}
+
+	return 0
+}
+
+// indexKeyLimit  get the bytes of a character in the rule columns and the max bytes of an index key,
+// MySQL (InnoDB) limits the key to 3072 bytes and stores utf8mb4 in 4 bytes,
+// SQLServer limits the nonclustered key to 1700 bytes and stores NVARCHAR in 2 bytes.
+// The max bytes is 0 if the key length is not checked.
+func (d Dialect) indexKeyLimit() (charBytes, maxBytes int) {
+	switch d {
+	case DialectMysql:
+		return 4, 3072
+	case DialectSqlserver:
+		return 2, 1700
+	case DialectGeneric, DialectPostgres, DialectCockroach, DialectSqlite3, DialectOracle, DialectDuckdb:
+	}
+
+	return 0, 0
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The errors returned by the Adapter, use errors.Is to check them.
+var (
+	// ErrInvalidFilter  the filter of LoadFilteredPolicy is not a *Filter or has no condition.
+	ErrInvalidFilter = errors.New("sqlxadapter: invalid filter")
+	// ErrRuleTooLong  the rule has more values than the columns v0 ~ v5.
+	ErrRuleTooLong = errors.New("sqlxadapter: rule is too long")
+	// ErrRuleCountMismatch  the old rules count is not equal to the new rules count.
+	ErrRuleCountMismatch = errors.New("sqlxadapter: rule count mismatch")
+	// ErrDuplicate  the rule violates a unique index.
+	ErrDuplicate = errors.New("sqlxadapter: duplicate rule")
+	// ErrTableMissing  the table does not exist.
+	ErrTableMissing = errors.New("sqlxadapter: table missing")
+	// ErrUnsupportedDriver  the driver can not be used by the Adapter.
+	ErrUnsupportedDriver = errors.New("sqlxadapter: unsupported driver")
+	// ErrNotFound  the rule to remove or update is not in the table, only returned in the strict mode.
+	ErrNotFound = errors.New("sqlxadapter: rule not found")
+	// ErrInvalidFieldIndex  the field index is negative or the field values are out of the columns v0 ~ v5.
+	ErrInvalidFieldIndex = errors.New("sqlxadapter: invalid field index")
+	// ErrWipeRefused  the filtered removal matches the whole ptype, refused by the wipe guard.
+	ErrWipeRefused = errors.New("sqlxadapter: wipe refused")
+	// ErrClosed  the Adapter is closed.
+	ErrClosed = errors.New("sqlxadapter: adapter closed")
+	// ErrVersionDisabled  the Adapter is not created with WithVersion or WithChangelog.
+	ErrVersionDisabled = errors.New("sqlxadapter: version disabled")
+	// ErrChangelogDisabled  the Adapter is not created with WithChangelog.
+	ErrChangelogDisabled = errors.New("sqlxadapter: changelog disabled")
+	// ErrNotifyDisabled  the Adapter is not created with WithNotify.
+	ErrNotifyDisabled = errors.New("sqlxadapter: notify disabled")
+	// ErrAuditDisabled  the Adapter is not created with WithAudit.
+	ErrAuditDisabled = errors.New("sqlxadapter: audit disabled")
+	// ErrHistoryDisabled  the Adapter is not created with WithHistory.
+	ErrHistoryDisabled = errors.New("sqlxadapter: history disabled")
+	// ErrSnapshotNotFound  the snapshot to restore or delete does not exist.
+	ErrSnapshotNotFound = errors.New("sqlxadapter: snapshot not found")
+	// ErrSoftDeleteDisabled  the Adapter is not created with WithSoftDelete.
+	ErrSoftDeleteDisabled = errors.New("sqlxadapter: soft delete disabled")
+	// ErrExpiryDisabled  the Adapter is not created with WithExpiry.
+	ErrExpiryDisabled = errors.New("sqlxadapter: expiry disabled")
+	// ErrTenantDisabled  the Adapter is not created with WithTenantColumn.
+	ErrTenantDisabled = errors.New("sqlxadapter: tenant column disabled")
+)
+
+// OpError  records the failed operation of the Adapter with the table and the rule.
+// The driver error is kept in Err, use errors.As to get it.
+type OpError struct {
+	// Op  the operation, such as "AddPolicy".
+	Op string
+	// Table  the table name.
+	Table string
+	// Rule  the rule which caused the error, it starts with the ptype, it may be nil.
+	Rule []string
+	// Err  the underlying error.
+	Err error
+}
+
+// Error  implements the error interface.
+func (e *OpError) Error() string {
+	var buf strings.Builder
+
+	buf.Grow(64)
+	buf.WriteString("sqlxadapter: ")
+	buf.WriteString(e.Op)
+	buf.WriteString(" table ")
+	buf.WriteString(e.Table)
+
+	if len(e.Rule) > 0 {
+		buf.WriteString(" rule [")
+		buf.WriteString(strings.Join(e.Rule, ","))
+		buf.WriteByte(']')
+	}
+
+	if e.Err != nil {
+		buf.WriteString(": ")
+		buf.WriteString(e.Err.Error())
+	}
+
+	return buf.String()
+}
+
+// Unwrap  returns the underlying error.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// opError  wrap the error with the operation context, it returns nil if err == nil.
+// The driver errors are classified to ErrDuplicate and ErrTableMissing.
+func (p *Adapter) opError(op string, rule []string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// the rule which failed in a batch.
+	if e, ok := err.(*OpError); ok && e.Op == "" { //nolint:errorlint // only the unwrapped batch error is filled.
+		e.Op = op
+		e.Table = p.tableName
+		e.Err = p.dialect.classifyError(e.Err)
+
+		return e
+	}
+
+	return &OpError{Op: op, Table: p.tableName, Rule: rule, Err: p.dialect.classifyError(err)}
+}
+
+// classifyError  wrap the driver error with ErrDuplicate or ErrTableMissing if it matches.
+func (d Dialect) classifyError(err error) error {
+	switch {
+	case errors.Is(err, ErrDuplicate), errors.Is(err, ErrTableMissing):
+		return err
+	case d.isDuplicateError(err):
+		return fmt.Errorf("%w: %w", ErrDuplicate, err)
+	case d.isTableMissingError(err):
+		return fmt.Errorf("%w: %w", ErrTableMissing, err)
+	}
+
+	return err
+}
+
+// isDuplicateError  check the driver error is a unique violation.
+func (d Dialect) isDuplicateError(err error) bool {
+	msg := err.Error()
+
+	switch d {
+	case DialectPostgres, DialectCockroach:
+		var stater sqlStater
+		if errors.As(err, &stater) {
+			return stater.SQLState() == "23505"
+		}
+
+		return strings.Contains(msg, "duplicate key")
+	case DialectMysql:
+		// the message of the driver error is prefixed by the wrappers.
+		return strings.HasPrefix(rootCause(err).Error(), "Error 1062")
+	case DialectSqlserver:
+		var numberer sqlErrorNumberer
+		if errors.As(err, &numberer) {
+			return numberer.SQLErrorNumber() == 2627 || numberer.SQLErrorNumber() == 2601
+		}
+	case DialectSqlite3:
+		return strings.Contains(msg, "UNIQUE constraint failed")
+	case DialectOracle:
+		return strings.Contains(msg, "ORA-00001")
+	case DialectDuckdb:
+		return strings.Contains(msg, "Duplicate key")
+	case DialectGeneric:
+	}
+
+	return false
+}
+
+// isTableMissingError  check the driver error is caused by a missing table.
+func (d Dialect) isTableMissingError(err error) bool {
+	msg := err.Error()
+
+	switch d {
+	case DialectPostgres, DialectCockroach:
+		var stater sqlStater
+		if errors.As(err, &stater) {
+			return stater.SQLState() == "42P01"
+		}
+
+		return strings.Contains(msg, "relation") && strings.Contains(msg, "does not exist")
+	case DialectMysql:
+		return strings.HasPrefix(rootCause(err).Error(), "Error 1146")
+	case DialectSqlserver:
+		var numberer sqlErrorNumberer
+		if errors.As(err, &numberer) {
+			return numberer.SQLErrorNumber() == 208
+		}
+	case DialectSqlite3:
+		return strings.Contains(msg, "no such table")
+	case DialectOracle:
+		return strings.Contains(msg, "ORA-00942")
+	case DialectDuckdb:
+		return strings.Contains(msg, "Table with name") && strings.Contains(msg, "does not exist")
+	case DialectGeneric:
+	}
+
+	return false
+}
@@ -0,0 +1,252 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// expiryColumns  the columns of the expiry mode, a row is valid in [valid_from, expires_at).
+var expiryColumns = []column{
+	{name: "valid_from", typ: "BIGINT NULL", typeOracle: "NUMBER(19) NULL"},
+	{name: "expires_at", typ: "BIGINT NULL", typeOracle: "NUMBER(19) NULL"},
+}
+
+// genExpirySQL  generate the statements of the expiry mode, it must be called after genScopeSQL.
+// The loads exclude the rows out of their window, the deleteAll of SavePolicy keeps the time-bounded rows.
+func (p *Adapter) genExpirySQL() {
+	p.sqlSelectLoad = addCondition(p.sqlSelectAll, sqlValidCondition)
+	p.sqlSelectLoadWhere = addCondition(p.sqlSelectWhere, sqlValidCondition)
+	p.sqlSelectWindowed = addCondition(p.sqlSelectAll, sqlWindowedCondition)
+	p.sqlDeleteAll = addCondition(p.sqlDeleteAll, sqlUnboundCondition)
+	p.sqlSelectReplaced = addCondition(p.sqlSelectAll, sqlUnboundCondition)
+
+	p.sqlPurgeExpired = fmt.Sprintf(sqlPurgeExpired, p.tableName)
+	p.sqlSelectExpired = fmt.Sprintf(sqlSelectExpired, p.tableName)
+	p.sqlPurgeExpiredReturning = ""
+
+	if p.dialect == DialectOracle {
+		p.sqlSelectValidRule = p.sqlSelectLoadWhere + sqlRuleConditionOracle
+	} else {
+		p.sqlSelectValidRule = p.sqlSelectLoadWhere + sqlRuleCondition
+	}
+
+	switch p.dialect {
+	case DialectMysql, DialectOracle:
+		p.sqlSelectExpired += sqlForUpdate
+	case DialectSqlserver:
+		p.sqlPurgeExpiredReturning = fmt.Sprintf(sqlPurgeExpiredSqlserver, p.tableName)
+	case DialectGeneric, DialectPostgres, DialectCockroach, DialectSqlite3, DialectDuckdb:
+	}
+
+	if p.scope != "" {
+		p.sqlPurgeExpired = p.scoped(p.sqlPurgeExpired)
+		p.sqlSelectExpired = p.scoped(p.sqlSelectExpired)
+
+		if p.sqlPurgeExpiredReturning != "" {
+			p.sqlPurgeExpiredReturning = p.scoped(p.sqlPurgeExpiredReturning)
+		}
+	}
+
+	if p.sqlReturning != "" {
+		p.sqlPurgeExpiredReturning = p.sqlPurgeExpired + p.sqlReturning
+	}
+
+	p.sqlSelectWindowed = p.dialect.rebind(p.sqlSelectWindowed)
+	p.sqlPurgeExpired = p.dialect.rebind(p.sqlPurgeExpired)
+	p.sqlSelectExpired = p.dialect.rebind(p.sqlSelectExpired)
+	p.sqlPurgeExpiredReturning = p.dialect.rebind(p.sqlPurgeExpiredReturning)
+	p.sqlSelectValidRule = p.dialect.rebind(p.sqlSelectValidRule)
+}
+
+// loadArgs  the head args of the load statements, they are the current time in the expiry mode,
+// and scopeArgs.
+func (p *Adapter) loadArgs() []interface{} {
+	if !p.expiry {
+		return p.scopeArgs()
+	}
+
+	now := time.Now().UnixNano()
+
+	return append([]interface{}{now, now}, p.scopeArgs()...)
+}
+
+// skipWindowedRows  remove the rules which have the time-bounded rows from the rules to insert,
+// so SavePolicy does not insert the loaded time-bounded rules again as the unbounded rules.
+func (p *Adapter) skipWindowedRows(ctx context.Context, tx *sqlx.Tx, rules [][]interface{}) ([][]interface{}, error) {
+	lines, err := p.queryRows(ctx, tx, p.sqlSelectWindowed, p.scopeArgs()...)
+	if err != nil || len(lines) == 0 {
+		return rules, err
+	}
+
+	windowed := make(map[string]struct{}, len(lines))
+	for _, line := range lines {
+		windowed[strings.Join(line.toRule(), "\x00")] = struct{}{}
+	}
+
+	rows := make([][]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		if _, ok := windowed[strings.Join(argsToRule(rule), "\x00")]; !ok {
+			rows = append(rows, rule)
+		}
+	}
+
+	return rows, nil
+}
+
+// AddPolicyWithExpiry  add a policy rule which is valid in [validFrom, expiresAt) to the storage,
+// the zero time means unbounded. It requires the Adapter to be created with WithExpiry.
+// The rule is excluded by the loads out of its window, so the enforcers must reload the policy to see the changes
+// of the window. The change is recorded by the audit in any case, but it is recorded in the change log
+// and notified only if the rule is valid now, because the peers apply it incrementally.
+func (p *Adapter) AddPolicyWithExpiry(ctx context.Context, sec, ptype string, rule []string, validFrom, expiresAt time.Time) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("AddPolicyWithExpiry", nil, err)
+	}
+	defer p.release()
+
+	if !p.expiry {
+		return p.opError("AddPolicyWithExpiry", nil, ErrExpiryDisabled)
+	}
+
+	if !validFrom.IsZero() && !expiresAt.IsZero() && !expiresAt.After(validFrom) {
+		return p.opError("AddPolicyWithExpiry", append([]string{ptype}, rule...),
+			fmt.Errorf("sqlxadapter: expires at %s is not after valid from %s", expiresAt, validFrom))
+	}
+
+	args, err := p.genArgs(ptype, rule)
+	if err == nil {
+		now := time.Now()
+
+		valid := (validFrom.IsZero() || !validFrom.After(now)) && (expiresAt.IsZero() || expiresAt.After(now))
+		changes := []*Change{{Op: OpAddPolicy, Sec: sec, PType: ptype, Rule: rule, auditOnly: !valid}}
+
+		_, err = p.exec(ctx, changes, false, p.sqlInsertRow, p.appendInsertArgs(args, now.UnixNano(), unixNanoOrNil(validFrom), unixNanoOrNil(expiresAt))...)
+	}
+
+	return p.opError("AddPolicyWithExpiry", append([]string{ptype}, rule...), err)
+}
+
+// unixNanoOrNil  the Unix time in nanoseconds of t, or nil if t is zero.
+func unixNanoOrNil(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t.UnixNano()
+}
+
+// PurgeExpired  delete the expired rows, returns the deleted rules which start with the ptype.
+// The deleted rules are recorded as RemovePolicy changes. It requires the Adapter to be created with WithExpiry.
+// A rule which is still valid in another row, e.g. an identical unbounded rule, is recorded by the audit only,
+// so the peers do not remove it from their models.
+func (p *Adapter) PurgeExpired(ctx context.Context) ([][]string, error) {
+	if err := p.acquire(); err != nil {
+		return nil, p.opError("PurgeExpired", nil, err)
+	}
+	defer p.release()
+
+	if !p.expiry {
+		return nil, p.opError("PurgeExpired", nil, ErrExpiryDisabled)
+	}
+
+	var lines []*CasbinRule
+
+	err := p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+		var err error
+
+		now := time.Now().UnixNano()
+
+		lines, err = p.purgeExpiredRows(ctx, tx, now)
+		if err != nil {
+			return nil, err
+		}
+
+		// the rule is published once, and only if no row of it is valid.
+		published := make(map[string]struct{}, len(lines))
+
+		changes := make([]*Change, 0, len(lines))
+		for _, line := range lines {
+			rule := line.toRule()
+			key := strings.Join(rule, "\x00")
+
+			_, auditOnly := published[key]
+			if !auditOnly {
+				if auditOnly, err = p.hasValidRow(ctx, tx, line, now); err != nil {
+					return nil, err
+				}
+
+				published[key] = struct{}{}
+			}
+
+			changes = append(changes, &Change{Op: OpRemovePolicy, Sec: ptypeSec(line.PType), PType: line.PType, Rule: rule[1:], auditOnly: auditOnly})
+		}
+
+		return changes, nil
+	})
+	if err != nil {
+		return nil, p.opError("PurgeExpired", nil, err)
+	}
+
+	rules := make([][]string, 0, len(lines))
+	for _, line := range lines {
+		rules = append(rules, line.toRule())
+	}
+
+	return rules, nil
+}
+
+// purgeExpiredRows  delete the rows which expired at now in the transaction, returns the deleted rows.
+func (p *Adapter) purgeExpiredRows(ctx context.Context, tx *sqlx.Tx, now int64) ([]*CasbinRule, error) {
+	args := append(p.scopeArgs(), now)
+
+	if p.sqlPurgeExpiredReturning != "" {
+		return p.queryRows(ctx, tx, p.sqlPurgeExpiredReturning, args...)
+	}
+
+	lines, err := p.queryRows(ctx, tx, p.sqlSelectExpired, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, p.sqlPurgeExpired, args...); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// hasValidRow  check the rule of the line has a row which is valid at now in the transaction.
+func (p *Adapter) hasValidRow(ctx context.Context, tx *sqlx.Tx, line *CasbinRule, now int64) (bool, error) {
+	args := append(append([]interface{}{now, now}, p.scopeArgs()...), line.PType, line.V0, line.V1, line.V2, line.V3, line.V4, line.V5)
+
+	lines, err := p.queryRows(ctx, tx, p.sqlSelectValidRule, args...)
+
+	return len(lines) > 0, err
+}
+
+// ptypeSec  the section of the ptype, "g" for the role definitions, otherwise "p".
+func ptypeSec(ptype string) string {
+	if strings.HasPrefix(ptype, "g") {
+		return "g"
+	}
+
+	return "p"
+}
@@ -7,4 +7,5 @@ require (
 	github.com/casbin/casbin/v3 v3.10.0
 	github.com/casbin/govaluate v1.10.0 // indirect
 	github.com/jmoiron/sqlx v1.4.0
+	github.com/lib/pq v1.10.9
 )
@@ -0,0 +1,114 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/casbin/casbin/v3/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// historyColumns  the columns of the history mode, a row is valid in [valid_from, valid_to),
+// the rows which exist before the history mode is enabled have no valid_from.
+var historyColumns = []column{
+	{name: "valid_from", typ: "BIGINT NULL", typeOracle: "NUMBER(19) NULL"},
+	{name: "valid_to", typ: "BIGINT NULL", typeOracle: "NUMBER(19) NULL"},
+}
+
+// enableHistory  restrict the statements to the current rows and tombstone the removed rows,
+// it must be called before genSQL.
+func (p *Adapter) enableHistory() {
+	p.addScope("valid_to IS NULL")
+	p.tombstone = "valid_to"
+	p.sqlSelectAsOf = p.tenanted(fmt.Sprintf(sqlSelectAsOf, p.tableName))
+}
+
+// LoadPolicyAsOf  load the policy rules which were valid at the time into the model,
+// it requires the Adapter to be created with WithHistory.
+func (p *Adapter) LoadPolicyAsOf(ctx context.Context, model model.Model, t time.Time) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("LoadPolicyAsOf", nil, err)
+	}
+	defer p.release()
+
+	if !p.history {
+		return p.opError("LoadPolicyAsOf", nil, ErrHistoryDisabled)
+	}
+
+	asOf := t.UnixNano()
+
+	lines, err := p.selectRows(ctx, p.sqlSelectAsOf, append(p.scopeArgs(), asOf, asOf)...)
+	if err != nil {
+		return p.opError("LoadPolicyAsOf", nil, err)
+	}
+
+	for _, line := range lines {
+		if err = p.loadPolicyLine(line, model); err != nil {
+			return p.opError("LoadPolicyAsOf", line.toRule(), err)
+		}
+	}
+
+	return nil
+}
+
+// updateHistory  close the old rows and insert the new rows in a transaction,
+// returns the count of the updated rules. The new row is valid from the time the old row is closed,
+// a new row is not inserted if the old rule is not found.
+// If mustAffect is true, an old rule which is not found fails the transaction with ErrNotFound.
+// The write hooks are skipped if no rule is updated.
+func (p *Adapter) updateHistory(ctx context.Context, changes []*Change, oldArgs, newArgs [][]interface{}, mustAffect bool) (int64, error) {
+	var affected int64
+
+	err := p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+		affected = 0
+
+		now := time.Now().UnixNano()
+
+		for idx := range oldArgs {
+			result, err := tx.ExecContext(ctx, p.sqlDeleteRow, append(append([]interface{}{now}, p.scopeArgs()...), oldArgs[idx]...)...)
+			if err != nil {
+				return nil, &OpError{Rule: argsToRule(oldArgs[idx]), Err: err}
+			}
+
+			n, err := result.RowsAffected()
+			if err != nil {
+				return nil, err
+			}
+
+			if n == 0 {
+				if mustAffect {
+					return nil, &OpError{Rule: argsToRule(oldArgs[idx]), Err: ErrNotFound}
+				}
+
+				continue
+			}
+
+			args := p.appendInsertArgs(append(make([]interface{}, 0, len(newArgs[idx])+1), newArgs[idx]...), now, nil, nil)
+
+			if _, err = tx.ExecContext(ctx, p.sqlInsertRow, args...); err != nil {
+				return nil, &OpError{Rule: argsToRule(newArgs[idx]), Err: err}
+			}
+
+			affected++
+		}
+
+		return affectedChanges(changes, affected), nil
+	})
+
+	return affected, err
+}
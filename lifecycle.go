@@ -0,0 +1,131 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"sync"
+)
+
+// lifecycle  tracks the in-flight operations and the background goroutines of the Adapter.
+type lifecycle struct {
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+	stoppers []func(ctx context.Context) error
+}
+
+// acquire  register an in-flight operation, it returns ErrClosed if the Adapter is closed.
+// release must be called when the operation finished.
+func (p *Adapter) acquire() error {
+	p.life.mu.Lock()
+	defer p.life.mu.Unlock()
+
+	if p.life.closed {
+		return ErrClosed
+	}
+
+	p.life.inflight.Add(1)
+
+	return nil
+}
+
+// release  unregister an in-flight operation.
+func (p *Adapter) release() {
+	p.life.inflight.Done()
+}
+
+// onClose  register a function to stop a background goroutine, it is called by Close
+// before draining the in-flight operations, it is called at once if the Adapter is closed.
+func (p *Adapter) onClose(ctx context.Context, stop func(ctx context.Context) error) error {
+	p.life.mu.Lock()
+
+	if p.life.closed {
+		p.life.mu.Unlock()
+
+		return stop(ctx)
+	}
+
+	p.life.stoppers = append(p.life.stoppers, stop)
+	p.life.mu.Unlock()
+
+	return nil
+}
+
+// OnClose  registers a function to stop a background goroutine which works for the Adapter,
+// such as the Watcher of the pqnotify package, Close calls it before draining the in-flight operations.
+// It returns ErrClosed if the Adapter is closed, the function is not called in that case.
+func (p *Adapter) OnClose(stop func(ctx context.Context) error) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("OnClose", nil, err)
+	}
+	defer p.release()
+
+	return p.onClose(p.ctx, stop)
+}
+
+// Close  stops the background goroutines, waits for the in-flight operations to finish,
+// and releases the cached prepared statements, the db is owned by the user and not closed.
+// The operations after Close return ErrClosed, calling Close again returns nil.
+//
+// If ctx is done before the in-flight operations finish, Close returns the context error,
+// the statements are released after they finish.
+func (p *Adapter) Close(ctx context.Context) error {
+	p.life.mu.Lock()
+
+	if p.life.closed {
+		p.life.mu.Unlock()
+
+		return nil
+	}
+
+	p.life.closed = true
+	stoppers := p.life.stoppers
+	p.life.stoppers = nil
+	p.life.mu.Unlock()
+
+	var err error
+
+	for idx := len(stoppers) - 1; idx >= 0; idx-- {
+		if err1 := stoppers[idx](ctx); err1 != nil && err == nil {
+			err = err1
+		}
+	}
+
+	drained := make(chan error, 1)
+
+	go func() {
+		p.life.inflight.Wait()
+
+		if p.stmts != nil {
+			drained <- p.stmts.close()
+		} else {
+			drained <- nil
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	case err1 := <-drained:
+		if err == nil {
+			err = err1
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// maxNotifyPayload  PostgreSQL requires the payload of NOTIFY shorter than 8000 bytes.
+const maxNotifyPayload = 8000
+
+// notifyPayload  the payload of the notification.
+type notifyPayload struct {
+	Origin string `json:"origin"`
+	// Tenant  the tenant id of the Adapter which made the changes, the peers of the other tenants skip them.
+	Tenant  string    `json:"tenant,omitempty"`
+	Changes []*Change `json:"changes,omitempty"`
+	// Reload  the changes are too large for a notification, the peers should reload the policy.
+	Reload bool `json:"reload,omitempty"`
+}
+
+// enableNotify  notify the changes on the channel in the transaction of every write,
+// if the channel is "", the table name will be used.
+func (p *Adapter) enableNotify() error {
+	if p.dialect != DialectPostgres {
+		return fmt.Errorf("%w: LISTEN/NOTIFY requires PostgreSQL, dialect %q", ErrUnsupportedDriver, p.dialect)
+	}
+
+	if p.notifyChannel == "" {
+		p.notifyChannel = p.tableName
+	}
+
+	if err := p.initOrigin(); err != nil {
+		return err
+	}
+
+	query := p.dialect.rebind(sqlNotifyPostgres)
+	channel := p.notifyChannel
+
+	p.writeHooks = append(p.writeHooks, func(ctx context.Context, tx *sqlx.Tx, changes []*Change) error {
+		if changes = appliedChanges(changes); len(changes) == 0 {
+			return nil
+		}
+
+		payload, err := p.notifyPayload(ctx, changes)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, query, channel, payload)
+
+		return err
+	})
+
+	return nil
+}
+
+// notifyPayload  generate the payload of the changes,
+// if it is too large for a notification, the payload asks the peers to reload the policy.
+func (p *Adapter) notifyPayload(ctx context.Context, changes []*Change) (string, error) {
+	actor := ActorFromContext(ctx)
+	createdAt := time.Now()
+
+	list := make([]*Change, 0, len(changes))
+	for idx, change := range changes {
+		c := *change
+		c.Index = idx
+		c.Actor = actor
+		c.CreatedAt = createdAt
+
+		list = append(list, &c)
+	}
+
+	tenant := changes[0].Tenant
+
+	buf, err := json.Marshal(notifyPayload{Origin: p.origin, Tenant: tenant, Changes: list})
+	if err == nil && len(buf) >= maxNotifyPayload {
+		buf, err = json.Marshal(notifyPayload{Origin: p.origin, Tenant: tenant, Reload: true})
+	}
+
+	return string(buf), err
+}
+
+// NotifyChannel  returns the channel of WithNotify which the listeners listen on,
+// such as the Watcher of the pqnotify package.
+// It returns ErrNotifyDisabled if the Adapter is not created with WithNotify.
+func (p *Adapter) NotifyChannel() (string, error) {
+	if !p.notify {
+		return "", p.opError("NotifyChannel", nil, ErrNotifyDisabled)
+	}
+
+	return p.notifyChannel, nil
+}
+
+// DecodeNotification  decode the payload of a notification on the channel of WithNotify,
+// the changes made by the Adapter itself or by the other tenants are skipped and nil is returned.
+// If the changes are too large for a notification, a SavePolicy change is returned,
+// the policy should be reloaded in that case.
+func (p *Adapter) DecodeNotification(payload string) ([]Change, error) {
+	var n notifyPayload
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		return nil, p.opError("DecodeNotification", nil, err)
+	}
+
+	if n.Origin == p.origin || n.Tenant != p.tenant {
+		return nil, nil
+	}
+
+	if n.Reload {
+		return []Change{{Op: OpSavePolicy}}, nil
+	}
+
+	changes := make([]Change, 0, len(n.Changes))
+	for _, change := range n.Changes {
+		changes = append(changes, *change)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+// Option  configures the Adapter, used by NewAdapter and NewAdapterContext.
+type Option func(*Adapter)
+
+// Index  defines an index created together with the policy table.
+type Index struct {
+	// Name  the index name, if Name == "", it will be generated from the table name and columns.
+	Name string
+	// Columns  the indexed columns, must be "p_type" or "v0" ~ "v5".
+	Columns []string
+	// Unique  creates a unique index.
+	Unique bool
+	// Hash  indexes the SHA-256 hash of the columns instead of the columns on MySQL and SQLServer,
+	// so the key of any columns is within their limits, e.g. a unique index over all the rule columns.
+	// The hash is stored in the generated column "h_<index name>", it only supports the equality,
+	// and compares the values exactly, including the case and the trailing spaces.
+	// The other databases index the columns directly.
+	Hash bool
+}
+
+// WithIndexes  sets the indexes created with the policy table, it replaces the default
+// index "idx_<table> (p_type,v0,v1)", an empty list means no index will be created.
+//
+// The indexes only be created when the Adapter creates the table,
+// an existing table will not be changed.
+// An index whose key exceeds the limit of MySQL (3072 bytes) or SQLServer (1700 bytes) is rejected,
+// e.g. a unique index over all the rule columns, set Index.Hash to index the hash of the columns on them.
+//
+// Example:
+//
+//	WithIndexes(
+//	    Index{Columns: []string{"p_type", "v0", "v1"}},
+//	    Index{Columns: []string{"v1"}},
+//	    Index{Columns: []string{"v2"}},
+//	)
+func WithIndexes(indexes ...Index) Option {
+	return func(p *Adapter) {
+		p.indexes = make([]Index, len(indexes))
+		copy(p.indexes, indexes)
+	}
+}
+
+// WithDialect  sets the SQL dialect, it skips the dialect detection.
+// By default, the dialect is detected by the driver name, the driver type,
+// and then by probing the server version, DialectGeneric is used if all of them are unknown.
+func WithDialect(dialect Dialect) Option {
+	return func(p *Adapter) {
+		p.dialect = dialect
+	}
+}
+
+// WithRetryPolicy  sets the retry policy of every query and transaction,
+// by default, only CockroachDB retries the transient errors.
+//
+// Example:
+//
+//	WithRetryPolicy(RetryPolicy{
+//	    MaxAttempts: 5,
+//	    Backoff:     20 * time.Millisecond,
+//	    MaxBackoff:  time.Second,
+//	    Jitter:      0.2,
+//	})
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(p *Adapter) {
+		p.retry = &policy
+	}
+}
+
+// WithStrict  sets the strict mode, by default, it is lenient.
+// In the strict mode, RemovePolicy, RemovePolicies, RemoveFilteredPolicy, UpdatePolicy
+// and UpdatePolicies return ErrNotFound if the rule is not in the table,
+// so the drift between the enforcer and the table can be detected.
+//
+// MySQL reports the changed rows of an UPDATE by default, updating a rule to itself
+// affects no row, set "clientFoundRows=true" in the DSN to report the matched rows.
+func WithStrict(strict bool) Option {
+	return func(p *Adapter) {
+		p.strict = strict
+	}
+}
+
+// WithWipeGuard  enables the wipe guard, it is disabled by default.
+// The filtered removals, RemoveFilteredPolicy, RemoveFilteredPolicyReturning and UpdateFilteredPolicies,
+// return ErrWipeRefused if all the field values are empty, which would remove every rule of the ptype,
+// except the ptypes listed in allowedPtypes.
+//
+// Example:
+//
+//	WithWipeGuard("g2")
+func WithWipeGuard(allowedPtypes ...string) Option {
+	return func(p *Adapter) {
+		p.wipeGuard = true
+		p.wipeAllowed = make([]string, len(allowedPtypes))
+		copy(p.wipeAllowed, allowedPtypes)
+	}
+}
+
+// WithCopyThreshold  sets the min rows to insert by "COPY FROM STDIN" instead of the multi-row INSERT statements,
+// it only works with PostgreSQL connected by github.com/lib/pq, the default is 1000, rows <= 0 disables it.
+// It is used by AddPolicies, SavePolicy and UpdateFilteredPolicies.
+// The pgx driver (github.com/jackc/pgx/v5/stdlib) is not supported, COPY is only reachable by its native CopyFrom,
+// so the rules are always inserted by the multi-row INSERT statements with pgx.
+func WithCopyThreshold(rows int) Option {
+	return func(p *Adapter) {
+		p.copyThreshold = rows
+	}
+}
+
+// WithStmtCache  enables the prepared statement cache, it is disabled by default.
+// The statements are prepared once against the db and reused by every call,
+// they are bound to the transactions by tx.StmtxContext.
+// Call Adapter.Close to release the cached statements.
+func WithStmtCache(enabled bool) Option {
+	return func(p *Adapter) {
+		if enabled {
+			p.stmts = newStmtCache()
+		} else {
+			p.stmts = nil
+		}
+	}
+}
+
+// WithVersion  bumps the version in the "<table>_version" table in the transaction of every write,
+// the version is polled by Watcher. Every instance which writes the policy should enable it,
+// including the instances which do not create a Watcher.
+func WithVersion() Option {
+	return func(p *Adapter) {
+		p.version = true
+	}
+}
+
+// WithChangelog  records every change of the policy rules in the "<table>_changelog" table,
+// in the same transaction as the write. It also enables the version table of the Watcher,
+// the changes of a transaction are recorded with the bumped version as the sequence number.
+// The recorded changes are tailed by ChangelogWatcher.
+func WithChangelog() Option {
+	return func(p *Adapter) {
+		p.changelog = true
+	}
+}
+
+// WithNotify  issues "NOTIFY" on the channel with the changes in the transaction of every write,
+// the notifications are received by the Watcher of the pqnotify package, if channel is "", the table name will be used.
+// It works on PostgreSQL only, every instance which writes the policy should enable it.
+func WithNotify(channel string) Option {
+	return func(p *Adapter) {
+		p.notify = true
+		p.notifyChannel = channel
+	}
+}
+
+// WithAudit  records every change of the policy rules in the "<table>_audit" table,
+// in the same transaction as the write, with the actor and the request ID taken from the context,
+// see WithActor and WithRequestID. The records are listed by Adapter.ListAudit.
+// The writes which fail or change no rule are not recorded.
+func WithAudit() Option {
+	return func(p *Adapter) {
+		p.audit = true
+	}
+}
+
+// WithHistory  keeps the history of the policy rules in the table, the rows are versioned
+// by the "valid_from" and "valid_to" columns which are added to the table if they do not exist.
+// The removed rows are closed by setting "valid_to" instead of being deleted, an update closes the old row
+// and inserts the new one. The current rules are the rows without "valid_to",
+// the rules at a point in time are loaded by Adapter.LoadPolicyAsOf.
+func WithHistory() Option {
+	return func(p *Adapter) {
+		p.history = true
+	}
+}
+
+// WithSoftDelete  keeps the removed policy rules in the table, the "deleted_at" column is added
+// to the table if it does not exist. The removals set "deleted_at" instead of deleting the rows,
+// and the loads, updates and removals only see the rows without "deleted_at".
+// The removed rules are restored by Adapter.RestorePolicy and deleted by Adapter.PurgeDeleted.
+// It can not be used together with WithHistory.
+func WithSoftDelete() Option {
+	return func(p *Adapter) {
+		p.softDelete = true
+	}
+}
+
+// WithExpiry  allows the time-bounded policy rules, the "valid_from" and "expires_at" columns are added
+// to the table if they do not exist. The loads exclude the rules out of their window [valid_from, expires_at),
+// the rules are added by Adapter.AddPolicyWithExpiry and the expired rows are deleted by Adapter.PurgeExpired.
+// It can not be used together with WithHistory.
+func WithExpiry() Option {
+	return func(p *Adapter) {
+		p.expiry = true
+	}
+}
+
+// WithTenantColumn  enables the tenant mode, the "tenant_id" column is added to the table if it does not exist.
+// The Adapter scoped to a tenant is returned by Adapter.ForTenant, the Adapter itself works on the rows without tenant id.
+func WithTenantColumn() Option {
+	return func(p *Adapter) {
+		p.tenantColumn = true
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pqnotify  the watcher for Casbin on PostgreSQL LISTEN/NOTIFY by github.com/lib/pq,
+// it is a separate package so the users of the other databases do not import lib/pq.
+package pqnotify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v3/model"
+	"github.com/casbin/casbin/v3/persist"
+	"github.com/lib/pq"
+
+	sqlxadapter "github.com/Blank-Xu/sqlx-adapter"
+)
+
+// the reconnect intervals and the ping interval of the listener connection.
+const (
+	minReconnect = 10 * time.Second
+	maxReconnect = time.Minute
+	pingInterval = 90 * time.Second
+)
+
+// Watcher  the watcher for Casbin on PostgreSQL LISTEN/NOTIFY.
+// The Adapter issues "NOTIFY" with the changes in the transaction of every write,
+// so the notification is delivered only if the transaction is committed.
+// The Watcher listens on a dedicated connection which is reconnected automatically,
+// and passes the changes made by the other instances to the change callback.
+// The Watcher of the Adapter returned by ForTenant only passes the changes of the tenant.
+type Watcher struct {
+	adapter  *sqlxadapter.Adapter
+	listener *pq.Listener
+
+	mu             sync.Mutex
+	callback       func(string)
+	changeCallback func(sqlxadapter.Change)
+	errorCallback  func(error)
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ persist.WatcherEx = (*Watcher)(nil)
+
+// NewWatcher  the constructor for Watcher, it listens on the channel of sqlxadapter.WithNotify,
+// dataSourceName is used by lib/pq to open the dedicated listener connection.
+//
+// The Adapter must be created with WithNotify, and every instance which writes the policy should be created with it.
+// Create only one Watcher for each Adapter.
+// The Watcher is closed by Watcher.Close or Adapter.Close.
+//
+// Example:
+//
+//	a, err := sqlxadapter.NewAdapter(db, "casbin_rule", sqlxadapter.WithNotify(""))
+//	...
+//	w, err := pqnotify.NewWatcher(a, dataSourceName)
+//	...
+//	_ = e.SetWatcher(w)
+//	w.SetChangeCallback(func(c sqlxadapter.Change) {
+//	    _ = sqlxadapter.ApplyChange(e, c)
+//	})
+func NewWatcher(a *sqlxadapter.Adapter, dataSourceName string) (*Watcher, error) {
+	channel, err := a.NotifyChannel()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	w := &Watcher{
+		adapter: a,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	w.listener, err = listen(dataSourceName, channel, func(err error) {
+		w.failed(ctx, fmt.Errorf("pqnotify: connection of channel %q failed: %w", channel, err))
+	})
+	if err != nil {
+		cancel()
+
+		return nil, fmt.Errorf("pqnotify: listen on channel %q failed: %w", channel, err)
+	}
+
+	go w.run(ctx)
+
+	if err = a.OnClose(w.stop); err != nil {
+		_ = w.stop(context.Background())
+
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// listen  open the listener connection and listen on the channel,
+// it fails if the first connection attempt fails, the later connection losses are reconnected.
+// The errors of the connection losses and the failed connection attempts are passed to onError.
+func listen(dataSourceName, channel string, onError func(error)) (*pq.Listener, error) {
+	failed := make(chan error, 1)
+
+	listener := pq.NewListener(dataSourceName, minReconnect, maxReconnect, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventConnectionAttemptFailed:
+			select {
+			case failed <- err:
+			default:
+			}
+
+			onError(err)
+		case pq.ListenerEventDisconnected:
+			onError(err)
+		case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+		}
+	})
+
+	listened := make(chan error, 1)
+
+	go func() {
+		listened <- listener.Listen(channel)
+	}()
+
+	select {
+	case err := <-listened:
+		if err != nil {
+			_ = listener.Close()
+
+			return nil, err
+		}
+
+		return listener, nil
+	case err := <-failed:
+		// Close breaks the waiting Listen.
+		_ = listener.Close()
+		<-listened
+
+		return nil, err
+	}
+}
+
+// SetUpdateCallback  sets the callback function called with the payload
+// when the other instances changed the policy rules and no change callback is set.
+// After the listener connection is reconnected, it is called with "",
+// because the notifications may be lost.
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	w.callback = callback
+	w.mu.Unlock()
+
+	return nil
+}
+
+// SetChangeCallback  sets the callback function called with every change made by the other instances,
+// sqlxadapter.ApplyChange can be used to apply it. The policy should be reloaded if the notifications may be lost,
+// it is called with a SavePolicy change in that case.
+func (w *Watcher) SetChangeCallback(callback func(sqlxadapter.Change)) {
+	w.mu.Lock()
+	w.changeCallback = callback
+	w.mu.Unlock()
+}
+
+// SetErrorCallback  sets the callback function called with the error when a notification can not be decoded,
+// or the listener connection is lost or fails to reconnect, the changes may be lost in these cases.
+// The listener connection is reconnected automatically, and the policy should be reloaded after it is reconnected.
+func (w *Watcher) SetErrorCallback(callback func(error)) {
+	w.mu.Lock()
+	w.errorCallback = callback
+	w.mu.Unlock()
+}
+
+// Update  does nothing.
+func (w *Watcher) Update() error {
+	return nil
+}
+
+// UpdateForAddPolicy  does nothing, the changes have been notified by the Adapter in the transaction of the write.
+func (w *Watcher) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return nil
+}
+
+// UpdateForRemovePolicy  does nothing.
+func (w *Watcher) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return nil
+}
+
+// UpdateForRemoveFilteredPolicy  does nothing.
+func (w *Watcher) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return nil
+}
+
+// UpdateForSavePolicy  does nothing.
+func (w *Watcher) UpdateForSavePolicy(model model.Model) error {
+	return nil
+}
+
+// UpdateForAddPolicies  does nothing.
+func (w *Watcher) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return nil
+}
+
+// UpdateForRemovePolicies  does nothing.
+func (w *Watcher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return nil
+}
+
+// Close  stops listening, the callback functions will not be called any more.
+func (w *Watcher) Close() {
+	_ = w.stop(context.Background())
+}
+
+// stop  closes the listener and waits for the listening goroutine to exit.
+func (w *Watcher) stop(ctx context.Context) error {
+	w.closeOnce.Do(func() {
+		w.cancel()
+		w.closeErr = w.listener.Close()
+	})
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.done:
+		return w.closeErr
+	}
+}
+
+// run  receives the notifications until ctx is canceled or the listener is closed,
+// and pings the listener connection every interval to detect the connection loss.
+func (w *Watcher) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	notify := w.listener.NotificationChannel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-notify:
+			if !ok {
+				return
+			}
+
+			w.handle(ctx, n)
+		case <-ticker.C:
+			go func() { _ = w.listener.Ping() }()
+		}
+	}
+}
+
+// handle  decode the notification and call the callbacks,
+// a nil notification is sent after the connection is reconnected, the policy should be reloaded.
+func (w *Watcher) handle(ctx context.Context, n *pq.Notification) {
+	if n == nil {
+		w.dispatch(ctx, "", []sqlxadapter.Change{{Op: sqlxadapter.OpSavePolicy}})
+
+		return
+	}
+
+	changes, err := w.adapter.DecodeNotification(n.Extra)
+	if err != nil {
+		w.failed(ctx, err)
+
+		return
+	}
+
+	w.dispatch(ctx, n.Extra, changes)
+}
+
+// dispatch  call the change callback with every change, or the update callback with the payload.
+func (w *Watcher) dispatch(ctx context.Context, payload string, changes []sqlxadapter.Change) {
+	w.mu.Lock()
+	callback, changeCallback := w.callback, w.changeCallback
+	w.mu.Unlock()
+
+	if len(changes) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	if changeCallback != nil {
+		for _, change := range changes {
+			changeCallback(change)
+		}
+	} else if callback != nil {
+		callback(payload)
+	}
+}
+
+// failed  call the error callback with the error, the errors after the Watcher is closed are not passed.
+func (w *Watcher) failed(ctx context.Context, err error) {
+	w.mu.Lock()
+	errorCallback := w.errorCallback
+	w.mu.Unlock()
+
+	if errorCallback != nil && ctx.Err() == nil {
+		errorCallback(err)
+	}
+}
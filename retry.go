@@ -0,0 +1,173 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// RetryPolicy  defines how the failed adapter operations are retried.
+// A query or a single statement is retried alone,
+// a transaction is rolled back and replayed as a whole.
+type RetryPolicy struct {
+	// MaxAttempts  the max attempts of an operation, including the first one,
+	// the operation will not be retried if MaxAttempts <= 1.
+	MaxAttempts int
+	// Backoff  the wait time before the second attempt, it doubles on each attempt.
+	Backoff time.Duration
+	// MaxBackoff  the max wait time between two attempts.
+	MaxBackoff time.Duration
+	// Jitter  randomizes the wait time by ±Jitter, should be in [0, 1].
+	Jitter float64
+	// Classifier  check the error is retryable, if Classifier == nil, Dialect.IsRetryable will be used.
+	Classifier func(err error) bool
+}
+
+// defaultRetryPolicy  get the default retry policy of the dialect,
+// CockroachDB requires the clients to retry the serialization errors,
+// the other dialects are not retried by default.
+func defaultRetryPolicy(d Dialect) RetryPolicy {
+	if d == DialectCockroach {
+		return RetryPolicy{MaxAttempts: 5, Backoff: 50 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.2}
+	}
+
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// do  call fn until it succeeds, the error is not retryable, or the attempts are used up.
+func (r *RetryPolicy) do(ctx context.Context, d Dialect, fn func() error) error {
+	classifier := r.Classifier
+	if classifier == nil {
+		classifier = d.IsRetryable
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.MaxAttempts || !classifier(err) {
+			return err
+		}
+
+		if err = r.wait(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// wait  sleep with exponential backoff and jitter before the next attempt,
+// it returns the context error if the context is done.
+func (r *RetryPolicy) wait(ctx context.Context, attempt int) error {
+	backoff := r.Backoff << (attempt - 1)
+	if r.MaxBackoff > 0 && (backoff > r.MaxBackoff || backoff <= 0) {
+		backoff = r.MaxBackoff
+	}
+
+	if r.Jitter > 0 {
+		//nolint:gosec // the jitter does not need a secure random number.
+		backoff += time.Duration(float64(backoff) * r.Jitter * (2*rand.Float64() - 1))
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// sqlStater  the error returned by github.com/lib/pq and github.com/jackc/pgx.
+type sqlStater interface {
+	SQLState() string
+}
+
+// sqlErrorNumberer  the error returned by github.com/microsoft/go-mssqldb.
+type sqlErrorNumberer interface {
+	SQLErrorNumber() int32
+}
+
+// IsRetryable  check the error is transient for the dialect, such as deadlocks,
+// serialization failures and lock timeouts, the failed statement or transaction can be replayed safely.
+// Of the connection errors only driver.ErrBadConn is retryable, the drivers return it before anything is sent,
+// the errors such as "unexpected EOF", "broken pipe" and "connection reset" may arrive
+// after the server has executed the statement or the COMMIT, so they are not retried.
+func (d Dialect) IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	msg := err.Error()
+
+	switch d {
+	case DialectPostgres, DialectCockroach:
+		var stater sqlStater
+		if errors.As(err, &stater) {
+			switch stater.SQLState() {
+			// serialization_failure, deadlock_detected, lock_not_available
+			case "40001", "40P01", "55P03":
+				return true
+			}
+
+			return false
+		}
+
+		return strings.Contains(msg, "restart transaction")
+	case DialectMysql:
+		// deadlock, lock wait timeout, the message of the driver error is prefixed by the wrappers.
+		msg = rootCause(err).Error()
+
+		return strings.HasPrefix(msg, "Error 1213") || strings.HasPrefix(msg, "Error 1205")
+	case DialectSqlserver:
+		var numberer sqlErrorNumberer
+		if errors.As(err, &numberer) {
+			// deadlock victim, lock request time out
+			switch numberer.SQLErrorNumber() {
+			case 1205, 1222:
+				return true
+			}
+		}
+	case DialectSqlite3, DialectDuckdb:
+		return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked") ||
+			strings.Contains(msg, "Conflict on")
+	case DialectOracle:
+		// deadlock, can't serialize access, resource busy
+		return strings.Contains(msg, "ORA-00060") || strings.Contains(msg, "ORA-08177") || strings.Contains(msg, "ORA-00054")
+	case DialectGeneric:
+	}
+
+	return false
+}
+
+// rootCause  get the innermost error of the wrapped err.
+func rootCause(err error) error {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return err
+		}
+
+		err = inner
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// column  an extra column of the policy table added by a mode.
+type column struct {
+	name       string
+	typ        string
+	typeOracle string
+	indexed    bool
+}
+
+// addColumns  add the columns to the policy table if they do not exist,
+// the columns may be added by another instance at the same time.
+// The indexed columns are indexed by the instance which adds them.
+func (p *Adapter) addColumns(ctx context.Context, columns ...column) error {
+	for _, col := range columns {
+		if p.isColumnExist(ctx, col.name) {
+			continue
+		}
+
+		query := fmt.Sprintf(sqlAddColumn, p.tableName, col.name, col.typ)
+
+		switch p.dialect {
+		case DialectOracle:
+			query = fmt.Sprintf(sqlAddColumnOracle, p.tableName, col.name, col.typeOracle)
+		case DialectSqlserver:
+			query = fmt.Sprintf(sqlAddColumnSqlserver, p.tableName, col.name, col.typ)
+		case DialectGeneric, DialectPostgres, DialectCockroach, DialectMysql, DialectSqlite3, DialectDuckdb:
+		}
+
+		if _, err := p.db.ExecContext(ctx, query); err != nil {
+			if p.isColumnExist(ctx, col.name) {
+				continue
+			}
+
+			return err
+		}
+
+		if col.indexed {
+			query = fmt.Sprintf(sqlCreateIndex, "", "idx_"+p.tableName+"_"+col.name, p.tableName, col.name)
+			if _, err := p.db.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// isColumnExist  check the column of the policy table exists.
+func (p *Adapter) isColumnExist(ctx context.Context, name string) bool {
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf(sqlIsColumnExist, name, p.tableName))
+	if err != nil {
+		return false
+	}
+
+	return rows.Close() == nil
+}
+
+// addScope  restrict every read, update and delete to the condition.
+func (p *Adapter) addScope(cond string) {
+	if p.scope != "" {
+		p.scope += " AND "
+	}
+
+	p.scope += cond
+}
+
+// genScopeSQL  add the scope condition to the statements which read, update or delete the rows.
+func (p *Adapter) genScopeSQL() {
+	p.sqlSelectAll = p.scoped(p.sqlSelectAll)
+	p.sqlSelectWhere = p.scoped(p.sqlSelectWhere)
+	p.sqlUpdateRow = p.scoped(p.sqlUpdateRow)
+	p.sqlDeleteAll = p.scoped(p.sqlDeleteAll)
+	p.sqlDeleteRow = p.scoped(p.sqlDeleteRow)
+	p.sqlDeleteByArgs = p.scoped(p.sqlDeleteByArgs)
+
+	if p.dialect == DialectSqlserver {
+		// the rows values are joined, the condition is after the join, so its args are the tail args.
+		p.sqlDeleteRowsEnd += " WHERE " + p.scope
+		p.sqlDeleteReturning = p.scoped(p.sqlDeleteReturning)
+	} else if p.sqlDeleteRows != "" {
+		p.sqlDeleteRows = p.scoped(p.sqlDeleteRows)
+	}
+}
+
+// scoped  add the scope condition to the query.
+func (p *Adapter) scoped(query string) string {
+	return addCondition(query, p.scope)
+}
+
+// addCondition  add the condition as the first condition of the WHERE clause of the query,
+// or add the WHERE clause if the query does not have one.
+func addCondition(query, cond string) string {
+	if idx := strings.Index(query, " WHERE "); idx >= 0 {
+		return query[:idx] + " WHERE " + cond + " AND " + query[idx+len(" WHERE "):]
+	}
+
+	return query + " WHERE " + cond
+}
+
+// genTombstoneSQL  generate the statements which set the tombstone column instead of deleting the rows,
+// the tombstone column must be in the scope, so the removed rows are not matched again.
+func (p *Adapter) genTombstoneSQL() {
+	p.sqlDeleteAll = fmt.Sprintf(sqlTombstoneAll, p.tableName, p.tombstone)
+	p.sqlDeleteRow = fmt.Sprintf(sqlTombstoneRow, p.tableName, p.tombstone)
+	p.sqlDeleteByArgs = fmt.Sprintf(sqlTombstoneByArgs, p.tableName, p.tombstone)
+	p.sqlDeleteRows = fmt.Sprintf(sqlTombstoneRows, p.tableName, p.tombstone)
+
+	switch p.dialect {
+	case DialectSqlserver:
+		p.sqlDeleteReturning = fmt.Sprintf(sqlTombstoneReturningSqlserver, p.tableName, p.tombstone)
+		p.sqlDeleteRows = fmt.Sprintf(sqlTombstoneRowsSqlserver, p.tableName, p.tombstone)
+	case DialectOracle:
+		p.sqlDeleteRow = fmt.Sprintf(sqlTombstoneRowOracle, p.tableName, p.tombstone)
+		p.sqlDeleteRows = ""
+	case DialectGeneric, DialectPostgres, DialectCockroach, DialectMysql, DialectSqlite3, DialectDuckdb:
+	}
+}
+
+// tombstoneArgs  the args of the SET clause of the delete statements, it is now, the time of the removal,
+// if the rows are tombstoned, otherwise it is empty.
+func (p *Adapter) tombstoneArgs(now int64) []interface{} {
+	if p.tombstone == "" {
+		return nil
+	}
+
+	return []interface{}{now}
+}
+
+// scopeArgs  the args of the scope condition, it is the tenant id of the tenant Adapter,
+// otherwise it is empty. The scope condition is the first condition of the statements,
+// so the args are after the args of the SET clause and before the others.
+func (p *Adapter) scopeArgs() []interface{} {
+	if p.tenant == "" {
+		return nil
+	}
+
+	return []interface{}{p.tenant}
+}
+
+// deleteArgs  the head args of the delete statements, they are tombstoneArgs and scopeArgs.
+func (p *Adapter) deleteArgs(now int64) []interface{} {
+	return append(p.tombstoneArgs(now), p.scopeArgs()...)
+}
+
+// updateArgs  the args of the update statement, they are the new row in the SET clause, scopeArgs and the old row.
+func (p *Adapter) updateArgs(newArg, oldArg []interface{}) []interface{} {
+	args := make([]interface{}, 0, len(newArg)+len(oldArg)+1)
+	args = append(args, newArg...)
+	args = append(args, p.scopeArgs()...)
+
+	return append(args, oldArg...)
+}
+
+// insertColumns  the extra columns and their values of the INSERT statements added by the modes.
+func (p *Adapter) insertColumns() (columns, values string) {
+	if p.history {
+		columns += ",valid_from"
+		values += ",?"
+	}
+
+	if p.expiry {
+		columns += ",valid_from,expires_at"
+		values += ",?,?"
+	}
+
+	if p.tenantColumn {
+		columns += ",tenant_id"
+		values += ",?"
+	}
+
+	return columns, values
+}
+
+// insertArgs  append the args of the extra columns to the rows, the rows are copied if they are changed,
+// now is the valid_from of the history mode, it is the time the replaced rows are closed.
+func (p *Adapter) insertArgs(rules [][]interface{}, now int64) [][]interface{} {
+	if !p.history && !p.expiry && !p.tenantColumn {
+		return rules
+	}
+
+	rows := make([][]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		row := make([]interface{}, 0, len(rule)+3)
+		row = append(row, rule...)
+
+		rows = append(rows, p.appendInsertArgs(row, now, nil, nil))
+	}
+
+	return rows
+}
+
+// appendInsertArgs  append the args of the extra columns to the row in the order of insertColumns,
+// now is the valid_from of the history mode, validFrom and expiresAt are the window of the expiry mode,
+// nil means NULL. The tenant id is appended in the tenant mode.
+func (p *Adapter) appendInsertArgs(row []interface{}, now int64, validFrom, expiresAt interface{}) []interface{} {
+	if p.history {
+		row = append(row, now)
+	}
+
+	if p.expiry {
+		row = append(row, validFrom, expiresAt)
+	}
+
+	if p.tenantColumn {
+		row = append(row, tenantArg(p.tenant))
+	}
+
+	return row
+}
@@ -0,0 +1,298 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// the snapshots are stored in the "<table>_snapshot" table and their rules in the "<table>_snapshot_rule" table.
+const (
+	snapshotTableSuffix     = "_snapshot"
+	snapshotRuleTableSuffix = "_snapshot_rule"
+
+	// maxSnapshotNameLength  the max length of the snapshot name.
+	maxSnapshotNameLength = 128
+)
+
+// Snapshot  a named copy of the policy rules.
+type Snapshot struct {
+	Name      string
+	CreatedAt time.Time
+	// Rules  the count of the rules in the snapshot.
+	Rules int64
+}
+
+// snapshotRow  the row of the snapshot table.
+type snapshotRow struct {
+	Name      string `db:"name"`
+	CreatedAt int64  `db:"created_at"`
+	Rules     int64  `db:"rules"`
+}
+
+// ensureSnapshotTables  create the snapshot tables if they do not exist,
+// returns the names of the snapshot table and the snapshot rule table.
+func (p *Adapter) ensureSnapshotTables(ctx context.Context) (snapshotTable, ruleTable string, err error) {
+	snapshotTable = p.tableName + snapshotTableSuffix
+	ruleTable = p.tableName + snapshotRuleTableSuffix
+
+	sqlCreateTable := fmt.Sprintf(sqlCreateSnapshotTable, snapshotTable, p.snapshotStringType())
+	sqlCreateRuleTable := fmt.Sprintf(sqlCreateSnapshotRuleTable, ruleTable, p.snapshotStringType())
+
+	if p.dialect == DialectOracle {
+		sqlCreateTable = fmt.Sprintf(sqlCreateSnapshotTableOracle, snapshotTable)
+		sqlCreateRuleTable = fmt.Sprintf(sqlCreateSnapshotRuleTableOracle, ruleTable)
+	}
+
+	if err = p.ensureTable(ctx, snapshotTable, sqlCreateTable); err != nil {
+		return "", "", err
+	}
+
+	err = p.ensureTable(ctx, ruleTable, sqlCreateRuleTable,
+		fmt.Sprintf(sqlCreateIndex, "", "idx_"+ruleTable+"_name", ruleTable, "name"))
+
+	return snapshotTable, ruleTable, err
+}
+
+// snapshotStringType  the string type of the snapshot tables.
+func (p *Adapter) snapshotStringType() string {
+	switch p.dialect {
+	case DialectSqlserver:
+		return "NVARCHAR"
+	case DialectOracle:
+		return "NVARCHAR2"
+	case DialectGeneric, DialectPostgres, DialectCockroach, DialectMysql, DialectSqlite3, DialectDuckdb:
+	}
+
+	return "VARCHAR"
+}
+
+// checkSnapshotName  the snapshot name must not be empty or longer than maxSnapshotNameLength with the tenant prefix,
+// and it must not contain "/", which separates the tenant prefix.
+func (p *Adapter) checkSnapshotName(name string) error {
+	if name == "" || strings.Contains(name, "/") || len(p.snapshotPrefix())+len(name) > maxSnapshotNameLength {
+		return fmt.Errorf("sqlxadapter: invalid snapshot name %q", name)
+	}
+
+	return nil
+}
+
+// snapshotPrefix  the snapshots of a tenant are stored with the prefix "<tenant id>/",
+// so the tenants and the Adapter itself do not see the snapshots of the others.
+func (p *Adapter) snapshotPrefix() string {
+	if p.tenant == "" {
+		return ""
+	}
+
+	return p.tenant + "/"
+}
+
+// CreateSnapshot  copy the current policy rules into a snapshot with the name in a transaction,
+// it fails with ErrDuplicate if the snapshot exists.
+// It copies the rows which are replaced by RestoreSnapshot, so the time-bounded rows of the expiry mode
+// are not copied, otherwise they would be restored as the unbounded rules.
+func (p *Adapter) CreateSnapshot(ctx context.Context, name string) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("CreateSnapshot", nil, err)
+	}
+	defer p.release()
+
+	if err := p.checkSnapshotName(name); err != nil {
+		return p.opError("CreateSnapshot", nil, err)
+	}
+
+	name = p.snapshotPrefix() + name
+
+	snapshotTable, ruleTable, err := p.ensureSnapshotTables(ctx)
+	if err != nil {
+		return p.opError("CreateSnapshot", nil, err)
+	}
+
+	sqlInsert := p.dialect.rebind(fmt.Sprintf(sqlInsertSnapshot, snapshotTable))
+	sqlCopy := p.dialect.rebind(fmt.Sprintf(sqlCopySnapshotRules, ruleTable,
+		strings.TrimPrefix(p.sqlSelectReplaced, "SELECT "), p.snapshotStringType()))
+	sqlUpdate := p.dialect.rebind(fmt.Sprintf(sqlUpdateSnapshotRules, snapshotTable))
+
+	err = p.execTx(ctx, nil, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqlInsert, name, time.Now().UnixNano()); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, sqlCopy, append([]interface{}{name}, p.scopeArgs()...)...)
+		if err != nil {
+			return err
+		}
+
+		rules, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, sqlUpdate, rules, name)
+
+		return err
+	})
+
+	return p.opError("CreateSnapshot", nil, err)
+}
+
+// ListSnapshots  list the snapshots ordered by the creation time,
+// the Adapter returned by ForTenant only lists the snapshots of the tenant,
+// and the Adapter itself does not list the snapshots of the tenants.
+func (p *Adapter) ListSnapshots(ctx context.Context) ([]*Snapshot, error) {
+	if err := p.acquire(); err != nil {
+		return nil, p.opError("ListSnapshots", nil, err)
+	}
+	defer p.release()
+
+	snapshotTable, _, err := p.ensureSnapshotTables(ctx)
+	if err != nil {
+		return nil, p.opError("ListSnapshots", nil, err)
+	}
+
+	query := fmt.Sprintf(sqlSelectSnapshot, snapshotTable) + sqlOrderSnapshot
+
+	var rows []*snapshotRow
+
+	err = p.retry.do(ctx, p.dialect, func() error {
+		rows = rows[:0]
+
+		return sqlx.SelectContext(ctx, p.db, &rows, query)
+	})
+	if err != nil {
+		return nil, p.opError("ListSnapshots", nil, err)
+	}
+
+	prefix := p.snapshotPrefix()
+
+	snapshots := make([]*Snapshot, 0, len(rows))
+	for _, row := range rows {
+		if !strings.HasPrefix(row.Name, prefix) || strings.Contains(row.Name[len(prefix):], "/") {
+			continue
+		}
+
+		snapshots = append(snapshots, &Snapshot{Name: row.Name[len(prefix):], CreatedAt: time.Unix(0, row.CreatedAt), Rules: row.Rules})
+	}
+
+	return snapshots, nil
+}
+
+// RestoreSnapshot  replace the policy rules with the rules of the snapshot in a transaction,
+// it is recorded as a SavePolicy change. It fails with ErrSnapshotNotFound if the snapshot does not exist.
+func (p *Adapter) RestoreSnapshot(ctx context.Context, name string) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("RestoreSnapshot", nil, err)
+	}
+	defer p.release()
+
+	if err := p.checkSnapshotName(name); err != nil {
+		return p.opError("RestoreSnapshot", nil, err)
+	}
+
+	snapshotTable, ruleTable, err := p.ensureSnapshotTables(ctx)
+	if err != nil {
+		return p.opError("RestoreSnapshot", nil, err)
+	}
+
+	sqlSelect := p.dialect.rebind(fmt.Sprintf(sqlSelectSnapshot, snapshotTable) + " WHERE name=?")
+	sqlSelectRules := p.dialect.rebind(fmt.Sprintf(sqlSelectSnapshotRules, ruleTable))
+
+	name = p.snapshotPrefix() + name
+	changes := []*Change{{Op: OpSavePolicy}}
+
+	err = p.execTxChanges(ctx, func(tx *sqlx.Tx) ([]*Change, error) {
+		var row snapshotRow
+		if err := tx.GetContext(ctx, &row, sqlSelect, name); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrSnapshotNotFound
+			}
+
+			return nil, err
+		}
+
+		lines, err := p.queryRows(ctx, tx, sqlSelectRules, name)
+		if err != nil {
+			return nil, err
+		}
+
+		rules := make([][]interface{}, 0, len(lines))
+		for _, line := range lines {
+			rule := line.toRule()
+
+			args, err := p.genArgs(rule[0], rule[1:])
+			if err != nil {
+				return nil, err
+			}
+
+			rules = append(rules, args)
+		}
+
+		replaced, err := p.replaceRows(ctx, tx, rules)
+
+		return append(changes[:1:1], replaced...), err
+	})
+
+	return p.opError("RestoreSnapshot", nil, err)
+}
+
+// DeleteSnapshot  delete the snapshot and its rules in a transaction,
+// it fails with ErrSnapshotNotFound if the snapshot does not exist.
+func (p *Adapter) DeleteSnapshot(ctx context.Context, name string) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("DeleteSnapshot", nil, err)
+	}
+	defer p.release()
+
+	if err := p.checkSnapshotName(name); err != nil {
+		return p.opError("DeleteSnapshot", nil, err)
+	}
+
+	snapshotTable, ruleTable, err := p.ensureSnapshotTables(ctx)
+	if err != nil {
+		return p.opError("DeleteSnapshot", nil, err)
+	}
+
+	sqlDelete := p.dialect.rebind(fmt.Sprintf(sqlDeleteSnapshot, snapshotTable))
+	sqlDeleteRules := p.dialect.rebind(fmt.Sprintf(sqlDeleteSnapshot, ruleTable))
+
+	name = p.snapshotPrefix() + name
+
+	err = p.execTx(ctx, nil, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqlDeleteRules, name); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, sqlDelete, name)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err == nil && affected == 0 {
+			err = ErrSnapshotNotFound
+		}
+
+		return err
+	})
+
+	return p.opError("DeleteSnapshot", nil, err)
+}
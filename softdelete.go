@@ -0,0 +1,118 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// softDeleteColumns  the column of the soft delete mode, it is the time of the removal.
+var softDeleteColumns = []column{
+	{name: "deleted_at", typ: "BIGINT NULL", typeOracle: "NUMBER(19) NULL"},
+}
+
+// enableSoftDelete  restrict the statements to the rows which are not removed and tombstone the removed rows,
+// it must be called before genSQL.
+func (p *Adapter) enableSoftDelete() {
+	p.addScope("deleted_at IS NULL")
+	p.tombstone = "deleted_at"
+}
+
+// genSoftDeleteSQL  generate the statements to restore and purge the removed rows.
+func (p *Adapter) genSoftDeleteSQL() {
+	cond := sqlRuleCondition
+	if p.dialect == DialectOracle {
+		cond = sqlRuleConditionOracle
+	}
+
+	p.sqlSelectRule = p.dialect.rebind(p.sqlSelectWhere + cond)
+	p.sqlDeleteRemoved = p.dialect.rebind(p.tenanted(fmt.Sprintf(sqlDeleteRemoved, p.tableName)) + cond)
+	p.sqlPurgeDeleted = p.dialect.rebind(p.tenanted(fmt.Sprintf(sqlPurgeDeleted, p.tableName)))
+}
+
+// RestorePolicy  restore a removed policy rule, the removed rows of the rule are replaced by a current row,
+// it is recorded as an AddPolicy change. It requires the Adapter to be created with WithSoftDelete.
+// It fails with ErrNotFound if the rule is not removed, or ErrDuplicate if the rule exists.
+func (p *Adapter) RestorePolicy(ctx context.Context, sec, ptype string, rule []string) error {
+	if err := p.acquire(); err != nil {
+		return p.opError("RestorePolicy", nil, err)
+	}
+	defer p.release()
+
+	if !p.softDelete {
+		return p.opError("RestorePolicy", nil, ErrSoftDeleteDisabled)
+	}
+
+	args, err := p.genArgs(ptype, rule)
+	if err != nil {
+		return p.opError("RestorePolicy", append([]string{ptype}, rule...), err)
+	}
+
+	changes := []*Change{{Op: OpAddPolicy, Sec: sec, PType: ptype, Rule: rule}}
+
+	err = p.execTx(ctx, changes, func(tx *sqlx.Tx) error {
+		scopedArgs := append(p.scopeArgs(), args...)
+
+		lines, err := p.queryRows(ctx, tx, p.sqlSelectRule, scopedArgs...)
+		if err != nil {
+			return err
+		}
+
+		if len(lines) > 0 {
+			return ErrDuplicate
+		}
+
+		result, err := tx.ExecContext(ctx, p.sqlDeleteRemoved, scopedArgs...)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err == nil && affected == 0 {
+			err = ErrNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, p.sqlInsertRow, p.insertArgs([][]interface{}{args}, time.Now().UnixNano())[0]...)
+
+		return err
+	})
+
+	return p.opError("RestorePolicy", append([]string{ptype}, rule...), err)
+}
+
+// PurgeDeleted  delete the rows which were removed before olderThan ago, returns the count of the deleted rows.
+// It requires the Adapter to be created with WithSoftDelete.
+func (p *Adapter) PurgeDeleted(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if err := p.acquire(); err != nil {
+		return 0, p.opError("PurgeDeleted", nil, err)
+	}
+	defer p.release()
+
+	if !p.softDelete {
+		return 0, p.opError("PurgeDeleted", nil, ErrSoftDeleteDisabled)
+	}
+
+	affected, err := p.exec(ctx, nil, false, p.sqlPurgeDeleted, append(p.scopeArgs(), time.Now().Add(-olderThan).UnixNano())...)
+
+	return affected, p.opError("PurgeDeleted", nil, err)
+}
@@ -25,16 +25,24 @@ CREATE TABLE %[1]s(
     v3     VARCHAR(255),
     v4     VARCHAR(255),
     v5     VARCHAR(255)
-);
-CREATE INDEX idx_%[1]s ON %[1]s (p_type,v0,v1);`
+);`
+	sqlCreateIndex  = "CREATE %[1]sINDEX %[2]s ON %[3]s (%[4]s)"
 	sqlIsTableExist = "SELECT 1 FROM %s WHERE 1=0"
-	sqlInsertRow    = "INSERT INTO %s (p_type,v0,v1,v2,v3,v4,v5) VALUES (?,?,?,?,?,?,?)"
+	sqlInsertRows   = "INSERT INTO %s (p_type,v0,v1,v2,v3,v4,v5%s) VALUES "
+	sqlRowValues    = "(?,?,?,?,?,?,?)"
+	sqlInsertValues = "(?,?,?,?,?,?,?%s)"
 	sqlUpdateRow    = "UPDATE %s SET p_type=?,v0=?,v1=?,v2=?,v3=?,v4=?,v5=? WHERE p_type=? AND v0=? AND v1=? AND v2=? AND v3=? AND v4=? AND v5=?"
 	sqlDeleteAll    = "DELETE FROM %s"
 	sqlDeleteRow    = "DELETE FROM %s WHERE p_type=? AND v0=? AND v1=? AND v2=? AND v3=? AND v4=? AND v5=?"
 	sqlDeleteByArgs = "DELETE FROM %s WHERE p_type=?"
 	sqlSelectAll    = "SELECT p_type,v0,v1,v2,v3,v4,v5 FROM %s"
 	sqlSelectWhere  = "SELECT p_type,v0,v1,v2,v3,v4,v5 FROM %s WHERE "
+	sqlForUpdate    = " FOR UPDATE"
+	sqlReturning    = " RETURNING p_type,v0,v1,v2,v3,v4,v5"
+
+	// the rows values are between sqlDeleteRows and sqlDeleteRowsEnd.
+	sqlDeleteRows    = "DELETE FROM %s WHERE (p_type,v0,v1,v2,v3,v4,v5) IN ("
+	sqlDeleteRowsEnd = ")"
 )
 
 // for SQLite3.
@@ -62,8 +70,8 @@ CREATE TABLE IF NOT EXISTS %[1]s(
            LENGTH("v4") <= 255),
     CHECK (TYPEOF("v5") = "text" AND
            LENGTH("v5") <= 255)
-);
-CREATE INDEX IF NOT EXISTS idx_%[1]s ON %[1]s (p_type,v0,v1);`
+);`
+	sqlCreateIndexSqlite3 = "CREATE %[1]sINDEX IF NOT EXISTS %[2]s ON %[3]s (%[4]s)"
 )
 
 // for MySQL.
@@ -76,9 +84,11 @@ CREATE TABLE IF NOT EXISTS %[1]s(
     v2     VARCHAR(255) DEFAULT '' NOT NULL,
     v3     VARCHAR(255) DEFAULT '' NOT NULL,
     v4     VARCHAR(255) DEFAULT '' NOT NULL,
-    v5     VARCHAR(255) DEFAULT '' NOT NULL,
-    INDEX idx_%[1]s (p_type,v0,v1)
+    v5     VARCHAR(255) DEFAULT '' NOT NULL%[2]s
 ) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;`
+	sqlCreateIndexMysql = ",\n    %[1]sINDEX %[2]s (%[4]s)"
+	// the hash column of Index.Hash, the columns are separated by CHAR(0).
+	sqlAddHashColumnMysql = "ALTER TABLE %[1]s ADD COLUMN %[2]s BINARY(32) AS (UNHEX(SHA2(CONCAT_WS(CHAR(0),%[3]s),256))) STORED"
 )
 
 // for PostgreSQL.
@@ -92,11 +102,10 @@ CREATE TABLE IF NOT EXISTS %[1]s(
     v3     VARCHAR(255) DEFAULT '' NOT NULL,
     v4     VARCHAR(255) DEFAULT '' NOT NULL,
     v5     VARCHAR(255) DEFAULT '' NOT NULL
-);
-CREATE INDEX IF NOT EXISTS idx_%[1]s ON %[1]s (p_type,v0,v1);`
-	sqlInsertRowPostgres = "INSERT INTO %s (p_type,v0,v1,v2,v3,v4,v5) VALUES ($1,$2,$3,$4,$5,$6,$7)"
-	sqlUpdateRowPostgres = "UPDATE %s SET p_type=$1,v0=$2,v1=$3,v2=$4,v3=$5,v4=$6,v5=$7 WHERE p_type=$8 AND v0=$9 AND v1=$10 AND v2=$11 AND v3=$12 AND v4=$13 AND v5=$14"
-	sqlDeleteRowPostgres = "DELETE FROM %s WHERE p_type=$1 AND v0=$2 AND v1=$3 AND v2=$4 AND v3=$5 AND v4=$6 AND v5=$7"
+);`
+	sqlCreateIndexPostgres = "CREATE %[1]sINDEX IF NOT EXISTS %[2]s ON %[3]s (%[4]s)"
+	sqlCopyInPostgres      = "COPY %s (p_type,v0,v1,v2,v3,v4,v5%s) FROM STDIN"
+	sqlNotifyPostgres      = "SELECT pg_notify(?,?)"
 )
 
 // for SQLServer.
@@ -110,9 +119,296 @@ CREATE TABLE %[1]s(
     v3     NVARCHAR(255) DEFAULT '' NOT NULL,
     v4     NVARCHAR(255) DEFAULT '' NOT NULL,
     v5     NVARCHAR(255) DEFAULT '' NOT NULL
-);
-CREATE INDEX idx_%[1]s ON %[1]s (p_type, v0, v1);`
-	sqlInsertRowSqlserver = "INSERT INTO %s (p_type,v0,v1,v2,v3,v4,v5) VALUES (@p1,@p2,@p3,@p4,@p5,@p6,@p7)"
-	sqlUpdateRowSqlserver = "UPDATE %s SET p_type=@p1,v0=@p2,v1=@p3,v2=@p4,v3=@p5,v4=@p6,v5=@p7 WHERE p_type=@p8 AND v0=@p9 AND v1=@p10 AND v2=@p11 AND v3=@p12 AND v4=@p13 AND v5=@p14"
-	sqlDeleteRowSqlserver = "DELETE FROM %s WHERE p_type=@p1 AND v0=@p2 AND v1=@p3 AND v2=@p4 AND v3=@p5 AND v4=@p6 AND v5=@p7"
+);`
+	sqlDeleteReturningSqlserver = "DELETE FROM %s OUTPUT DELETED.p_type,DELETED.v0,DELETED.v1,DELETED.v2,DELETED.v3,DELETED.v4,DELETED.v5 WHERE p_type=?"
+
+	// SQLServer does not support the row values in IN, so the rows values are joined.
+	sqlDeleteRowsSqlserver    = "DELETE r FROM %s AS r INNER JOIN (VALUES "
+	sqlDeleteRowsEndSqlserver = ") AS d (p_type,v0,v1,v2,v3,v4,v5) ON r.p_type=d.p_type AND r.v0=d.v0 AND r.v1=d.v1 AND r.v2=d.v2 AND r.v3=d.v3 AND r.v4=d.v4 AND r.v5=d.v5"
+
+	// the hash column of Index.Hash, every column is followed by NCHAR(0), CONCAT takes NULL as ''.
+	sqlAddHashColumnSqlserver = "ALTER TABLE %[1]s ADD %[2]s AS CAST(HASHBYTES('SHA2_256',CONCAT(%[3]s)) AS BINARY(32)) PERSISTED"
+)
+
+// for Oracle.
+// Oracle stores empty strings as NULL, so the columns are nullable,
+// and the rule columns are compared by DECODE which treats two NULLs as equal.
+const (
+	sqlCreateTableOracle = `
+CREATE TABLE %[1]s(
+    p_type VARCHAR2(32),
+    v0     NVARCHAR2(255),
+    v1     NVARCHAR2(255),
+    v2     NVARCHAR2(255),
+    v3     NVARCHAR2(255),
+    v4     NVARCHAR2(255),
+    v5     NVARCHAR2(255)
+)`
+	sqlIsTableExistOracle = "SELECT COUNT(*) FROM USER_TABLES WHERE TABLE_NAME=UPPER('%s')"
+	sqlUpdateRowOracle    = "UPDATE %s SET p_type=?,v0=?,v1=?,v2=?,v3=?,v4=?,v5=? WHERE p_type=? AND DECODE(v0,?,1,0)=1 AND DECODE(v1,?,1,0)=1 AND DECODE(v2,?,1,0)=1 AND DECODE(v3,?,1,0)=1 AND DECODE(v4,?,1,0)=1 AND DECODE(v5,?,1,0)=1"
+	sqlDeleteRowOracle    = "DELETE FROM %s WHERE p_type=? AND DECODE(v0,?,1,0)=1 AND DECODE(v1,?,1,0)=1 AND DECODE(v2,?,1,0)=1 AND DECODE(v3,?,1,0)=1 AND DECODE(v4,?,1,0)=1 AND DECODE(v5,?,1,0)=1"
+)
+
+// for DuckDB.
+const (
+	sqlCreateTableDuckdb = `
+CREATE TABLE IF NOT EXISTS %[1]s(
+    p_type VARCHAR DEFAULT '' NOT NULL,
+    v0     VARCHAR DEFAULT '' NOT NULL,
+    v1     VARCHAR DEFAULT '' NOT NULL,
+    v2     VARCHAR DEFAULT '' NOT NULL,
+    v3     VARCHAR DEFAULT '' NOT NULL,
+    v4     VARCHAR DEFAULT '' NOT NULL,
+    v5     VARCHAR DEFAULT '' NOT NULL,
+    CHECK (LENGTH(p_type) <= 32),
+    CHECK (LENGTH(v0) <= 255),
+    CHECK (LENGTH(v1) <= 255),
+    CHECK (LENGTH(v2) <= 255),
+    CHECK (LENGTH(v3) <= 255),
+    CHECK (LENGTH(v4) <= 255),
+    CHECK (LENGTH(v5) <= 255)
+);`
+	sqlCreateIndexDuckdb  = "CREATE %[1]sINDEX IF NOT EXISTS %[2]s ON %[3]s (%[4]s)"
+	sqlIsTableExistDuckdb = "SELECT COUNT(*) FROM duckdb_tables() WHERE table_name='%s'"
+)
+
+// for the version table of the Watcher.
+const (
+	sqlCreateVersionTable = `
+CREATE TABLE %s(
+    id      INTEGER NOT NULL PRIMARY KEY,
+    version BIGINT  NOT NULL
+)`
+	sqlInitVersion   = "INSERT INTO %[1]s (id,version) SELECT 1,0 WHERE NOT EXISTS (SELECT 1 FROM %[1]s WHERE id=1)"
+	sqlBumpVersion   = "UPDATE %s SET version=version+1 WHERE id=1"
+	sqlSelectVersion = "SELECT version FROM %s WHERE id=1"
+
+	sqlCreateVersionTableOracle = `
+CREATE TABLE %s(
+    id      NUMBER(10) NOT NULL PRIMARY KEY,
+    version NUMBER(19) NOT NULL
+)`
+	// MySQL and Oracle require the FROM clause with WHERE.
+	sqlInitVersionFromDual = "INSERT INTO %[1]s (id,version) SELECT 1,0 FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM %[1]s WHERE id=1)"
+)
+
+// for the change log table.
+// The format args are [1]table name and [2]string type,
+// created_at is the Unix time in nanoseconds, so it is portable across the drivers.
+const (
+	sqlCreateChangelogTable = `
+CREATE TABLE %[1]s(
+    seq         BIGINT       NOT NULL,
+    idx         INTEGER      NOT NULL,
+    op          VARCHAR(32)  NOT NULL,
+    sec         VARCHAR(32),
+    p_type      VARCHAR(32),
+    field_index INTEGER,
+    v0          %[2]s(255),
+    v1          %[2]s(255),
+    v2          %[2]s(255),
+    v3          %[2]s(255),
+    v4          %[2]s(255),
+    v5          %[2]s(255),
+    o0          %[2]s(255),
+    o1          %[2]s(255),
+    o2          %[2]s(255),
+    o3          %[2]s(255),
+    o4          %[2]s(255),
+    o5          %[2]s(255),
+    actor       %[2]s(255),
+    origin      VARCHAR(64),
+    tenant_id   VARCHAR(128),
+    created_at  BIGINT       NOT NULL,
+    PRIMARY KEY (seq, idx)
+)`
+	sqlInsertChangelog = "INSERT INTO %s (seq,idx,op,sec,p_type,field_index,v0,v1,v2,v3,v4,v5,o0,o1,o2,o3,o4,o5,actor,origin,tenant_id,created_at) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	sqlSelectChangelog = "SELECT seq,idx,op,sec,p_type,field_index,v0,v1,v2,v3,v4,v5,o0,o1,o2,o3,o4,o5,actor,tenant_id,created_at FROM %s WHERE seq>? AND seq<=? AND origin<>? ORDER BY seq,idx"
+	sqlPurgeChangelog  = "DELETE FROM %s WHERE created_at<?"
+
+	sqlCreateChangelogTableOracle = `
+CREATE TABLE %[1]s(
+    seq         NUMBER(19)     NOT NULL,
+    idx         NUMBER(10)     NOT NULL,
+    op          VARCHAR2(32)   NOT NULL,
+    sec         VARCHAR2(32),
+    p_type      VARCHAR2(32),
+    field_index NUMBER(10),
+    v0          NVARCHAR2(255),
+    v1          NVARCHAR2(255),
+    v2          NVARCHAR2(255),
+    v3          NVARCHAR2(255),
+    v4          NVARCHAR2(255),
+    v5          NVARCHAR2(255),
+    o0          NVARCHAR2(255),
+    o1          NVARCHAR2(255),
+    o2          NVARCHAR2(255),
+    o3          NVARCHAR2(255),
+    o4          NVARCHAR2(255),
+    o5          NVARCHAR2(255),
+    actor       NVARCHAR2(255),
+    origin      VARCHAR2(64),
+    tenant_id   VARCHAR2(128),
+    created_at  NUMBER(19)     NOT NULL,
+    PRIMARY KEY (seq, idx)
+)`
+)
+
+// for the audit table.
+// The format args are [1]table name and [2]string type,
+// created_at is the Unix time in nanoseconds, the same as the change log table.
+const (
+	sqlCreateAuditTable = `
+CREATE TABLE %[1]s(
+    idx         INTEGER      NOT NULL,
+    op          VARCHAR(32)  NOT NULL,
+    sec         VARCHAR(32),
+    p_type      VARCHAR(32),
+    field_index INTEGER,
+    v0          %[2]s(255),
+    v1          %[2]s(255),
+    v2          %[2]s(255),
+    v3          %[2]s(255),
+    v4          %[2]s(255),
+    v5          %[2]s(255),
+    o0          %[2]s(255),
+    o1          %[2]s(255),
+    o2          %[2]s(255),
+    o3          %[2]s(255),
+    o4          %[2]s(255),
+    o5          %[2]s(255),
+    actor       %[2]s(255),
+    request_id  VARCHAR(128),
+    tenant_id   VARCHAR(128),
+    created_at  BIGINT       NOT NULL
+)`
+	sqlInsertAudit = "INSERT INTO %s (idx,op,sec,p_type,field_index,v0,v1,v2,v3,v4,v5,o0,o1,o2,o3,o4,o5,actor,request_id,tenant_id,created_at) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	sqlSelectAudit = "SELECT idx,op,sec,p_type,field_index,v0,v1,v2,v3,v4,v5,o0,o1,o2,o3,o4,o5,actor,request_id,tenant_id,created_at FROM %s WHERE 1=1"
+	sqlOrderAudit  = " ORDER BY created_at,idx"
+	sqlLimit       = " LIMIT %d"
+
+	sqlCreateAuditTableOracle = `
+CREATE TABLE %[1]s(
+    idx         NUMBER(10)     NOT NULL,
+    op          VARCHAR2(32)   NOT NULL,
+    sec         VARCHAR2(32),
+    p_type      VARCHAR2(32),
+    field_index NUMBER(10),
+    v0          NVARCHAR2(255),
+    v1          NVARCHAR2(255),
+    v2          NVARCHAR2(255),
+    v3          NVARCHAR2(255),
+    v4          NVARCHAR2(255),
+    v5          NVARCHAR2(255),
+    o0          NVARCHAR2(255),
+    o1          NVARCHAR2(255),
+    o2          NVARCHAR2(255),
+    o3          NVARCHAR2(255),
+    o4          NVARCHAR2(255),
+    o5          NVARCHAR2(255),
+    actor       NVARCHAR2(255),
+    request_id  VARCHAR2(128),
+    tenant_id   VARCHAR2(128),
+    created_at  NUMBER(19)     NOT NULL
+)`
+	// SQLServer and Oracle do not support LIMIT.
+	sqlFetchFirst = " OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY"
+)
+
+// for the extra columns of the modes.
+const (
+	sqlIsColumnExist      = "SELECT %s FROM %s WHERE 1=0"
+	sqlAddColumn          = "ALTER TABLE %s ADD COLUMN %s %s"
+	sqlAddColumnSqlserver = "ALTER TABLE %s ADD %s %s"
+	// Oracle requires the parentheses.
+	sqlAddColumnOracle = "ALTER TABLE %s ADD (%s %s)"
+)
+
+// for the tombstone of the history mode, the rows are not deleted,
+// the format arg [2] is the column which is set to the time of the removal.
+const (
+	sqlTombstoneAll    = "UPDATE %[1]s SET %[2]s=?"
+	sqlTombstoneRow    = "UPDATE %[1]s SET %[2]s=? WHERE p_type=? AND v0=? AND v1=? AND v2=? AND v3=? AND v4=? AND v5=?"
+	sqlTombstoneByArgs = "UPDATE %[1]s SET %[2]s=? WHERE p_type=?"
+	sqlTombstoneRows   = "UPDATE %[1]s SET %[2]s=? WHERE (p_type,v0,v1,v2,v3,v4,v5) IN ("
+
+	sqlTombstoneReturningSqlserver = "UPDATE %[1]s SET %[2]s=? OUTPUT DELETED.p_type,DELETED.v0,DELETED.v1,DELETED.v2,DELETED.v3,DELETED.v4,DELETED.v5 WHERE p_type=?"
+	sqlTombstoneRowsSqlserver      = "UPDATE r SET %[2]s=? FROM %[1]s AS r INNER JOIN (VALUES "
+
+	sqlTombstoneRowOracle = "UPDATE %[1]s SET %[2]s=? WHERE p_type=? AND DECODE(v0,?,1,0)=1 AND DECODE(v1,?,1,0)=1 AND DECODE(v2,?,1,0)=1 AND DECODE(v3,?,1,0)=1 AND DECODE(v4,?,1,0)=1 AND DECODE(v5,?,1,0)=1"
+)
+
+// for the history mode.
+const (
+	sqlSelectAsOf = "SELECT p_type,v0,v1,v2,v3,v4,v5 FROM %s WHERE (valid_from IS NULL OR valid_from<=?) AND (valid_to IS NULL OR valid_to>?)"
+)
+
+// for the snapshot tables, a snapshot is a row of the snapshot table and its rules in the snapshot rule table.
+// The format args are [1]table name and [2]string type, created_at is the Unix time in nanoseconds.
+const (
+	sqlCreateSnapshotTable = `
+CREATE TABLE %[1]s(
+    name       %[2]s(128) NOT NULL,
+    created_at BIGINT     NOT NULL,
+    rules      BIGINT     NOT NULL,
+    PRIMARY KEY (name)
+)`
+	sqlCreateSnapshotRuleTable = `
+CREATE TABLE %[1]s(
+    name   %[2]s(128) NOT NULL,
+    p_type VARCHAR(32),
+    v0     %[2]s(255),
+    v1     %[2]s(255),
+    v2     %[2]s(255),
+    v3     %[2]s(255),
+    v4     %[2]s(255),
+    v5     %[2]s(255)
+)`
+	sqlInsertSnapshot      = "INSERT INTO %s (name,created_at,rules) VALUES (?,?,0)"
+	sqlUpdateSnapshotRules = "UPDATE %s SET rules=? WHERE name=?"
+	sqlSelectSnapshot      = "SELECT name,created_at,rules FROM %s"
+	sqlOrderSnapshot       = " ORDER BY created_at,name"
+	sqlDeleteSnapshot      = "DELETE FROM %s WHERE name=?"
+	// the columns of the policy table are selected by the format arg [2].
+	sqlCopySnapshotRules   = "INSERT INTO %[1]s (name,p_type,v0,v1,v2,v3,v4,v5) SELECT CAST(? AS %[3]s(128)),%[2]s"
+	sqlSelectSnapshotRules = "SELECT p_type,v0,v1,v2,v3,v4,v5 FROM %s WHERE name=?"
+
+	sqlCreateSnapshotTableOracle = `
+CREATE TABLE %[1]s(
+    name       NVARCHAR2(128) NOT NULL,
+    created_at NUMBER(19)     NOT NULL,
+    rules      NUMBER(19)     NOT NULL,
+    PRIMARY KEY (name)
+)`
+	sqlCreateSnapshotRuleTableOracle = `
+CREATE TABLE %[1]s(
+    name   NVARCHAR2(128) NOT NULL,
+    p_type VARCHAR2(32),
+    v0     NVARCHAR2(255),
+    v1     NVARCHAR2(255),
+    v2     NVARCHAR2(255),
+    v3     NVARCHAR2(255),
+    v4     NVARCHAR2(255),
+    v5     NVARCHAR2(255)
+)`
+)
+
+// for the soft delete mode, the removed rows are the rows with deleted_at.
+const (
+	sqlRuleCondition = "p_type=? AND v0=? AND v1=? AND v2=? AND v3=? AND v4=? AND v5=?"
+	sqlDeleteRemoved = "DELETE FROM %s WHERE deleted_at IS NOT NULL AND "
+	sqlPurgeDeleted  = "DELETE FROM %s WHERE deleted_at<?"
+
+	sqlRuleConditionOracle = "p_type=? AND DECODE(v0,?,1,0)=1 AND DECODE(v1,?,1,0)=1 AND DECODE(v2,?,1,0)=1 AND DECODE(v3,?,1,0)=1 AND DECODE(v4,?,1,0)=1 AND DECODE(v5,?,1,0)=1"
+)
+
+// for the expiry mode, a row is valid in [valid_from, expires_at), NULL means unbounded.
+const (
+	sqlValidCondition    = "(valid_from IS NULL OR valid_from<=?) AND (expires_at IS NULL OR expires_at>?)"
+	sqlWindowedCondition = "(valid_from IS NOT NULL OR expires_at IS NOT NULL)"
+	sqlUnboundCondition  = "valid_from IS NULL AND expires_at IS NULL"
+	sqlPurgeExpired      = "DELETE FROM %s WHERE expires_at<=?"
+	sqlSelectExpired     = "SELECT p_type,v0,v1,v2,v3,v4,v5 FROM %s WHERE expires_at<=?"
+
+	sqlPurgeExpiredSqlserver = "DELETE FROM %s OUTPUT DELETED.p_type,DELETED.v0,DELETED.v1,DELETED.v2,DELETED.v3,DELETED.v4,DELETED.v5 WHERE expires_at<=?"
 )
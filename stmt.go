@@ -0,0 +1,88 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// stmtCache  caches the prepared statements by the SQL text,
+// the statements are prepared against the *sqlx.DB, database/sql prepares them
+// again on the other connections when needed.
+type stmtCache struct {
+	mu    sync.Mutex
+	stmts map[string]*sqlx.Stmt
+}
+
+// newStmtCache  the constructor for stmtCache.
+func newStmtCache() *stmtCache {
+	return &stmtCache{stmts: make(map[string]*sqlx.Stmt)}
+}
+
+// get  get the cached statement of the query, prepare and cache it if it is not found.
+func (c *stmtCache) get(ctx context.Context, db *sqlx.DB, query string) (*sqlx.Stmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := db.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.stmts[query] = stmt
+
+	return stmt, nil
+}
+
+// close  close all the cached statements and clear the cache, returns the first error.
+func (c *stmtCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+
+	for query, stmt := range c.stmts {
+		if err1 := stmt.Close(); err1 != nil && err == nil {
+			err = err1
+		}
+
+		delete(c.stmts, query)
+	}
+
+	return err
+}
+
+// prepareTx  get the statement of the query in the transaction,
+// the cached statement is bound to the transaction if the statement cache is enabled.
+// The returned statement must be closed, it does not close the cached statement.
+func (p *Adapter) prepareTx(ctx context.Context, tx *sqlx.Tx, query string) (*sqlx.Stmt, error) {
+	if p.stmts == nil {
+		return tx.PreparexContext(ctx, query)
+	}
+
+	stmt, err := p.stmts.get(ctx, p.db, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.StmtxContext(ctx, stmt), nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"fmt"
+)
+
+// maxTenantIDLength  the max length of the tenant id.
+const maxTenantIDLength = 128
+
+// tenantColumns  the column of the tenant mode, the rows of the Adapter itself have no tenant id,
+// the column is indexed when it is added.
+var tenantColumns = []column{
+	{name: "tenant_id", typ: "VARCHAR(128) NULL", typeOracle: "VARCHAR2(128) NULL", indexed: true},
+}
+
+// tenantCondition  the condition of the rows of the tenant, the tenant id is bound by scopeArgs.
+func (p *Adapter) tenantCondition() string {
+	if p.tenant == "" {
+		return "tenant_id IS NULL"
+	}
+
+	return "tenant_id=?"
+}
+
+// tenanted  add the tenant condition to the query in the tenant mode,
+// it is used by the statements which are not restricted by the scope of the modes,
+// their head args are scopeArgs.
+func (p *Adapter) tenanted(query string) string {
+	if !p.tenantColumn {
+		return query
+	}
+
+	return addCondition(query, p.tenantCondition())
+}
+
+// tenantArg  the arg of the tenant_id column of the tenant id, nil means the rows of the Adapter itself.
+func tenantArg(id string) interface{} {
+	if id == "" {
+		return nil
+	}
+
+	return id
+}
+
+// isTenantID  check the tenant id only contains letters, digits and "_-.:", and it is not too long.
+func isTenantID(id string) bool {
+	for _, c := range id {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') &&
+			c != '_' && c != '-' && c != '.' && c != ':' {
+			return false
+		}
+	}
+
+	return id != "" && len(id) <= maxTenantIDLength
+}
+
+// ForTenant  returns an Adapter scoped to the tenant, every select, insert, update and delete
+// of it is restricted to the rows of the tenant, including the deleteAll of SavePolicy.
+// It requires the Adapter to be created with WithTenantColumn, the Adapter itself works on the rows without tenant id.
+// The returned Adapter shares the db, the options and the lifecycle with the Adapter, Close closes all of them.
+func (p *Adapter) ForTenant(id string) (*Adapter, error) {
+	if !p.tenantColumn {
+		return nil, ErrTenantDisabled
+	}
+
+	if !isTenantID(id) {
+		return nil, fmt.Errorf("sqlxadapter: invalid tenant id %q", id)
+	}
+
+	tenant := *p
+	tenant.tenant = id
+	tenant.isFiltered = false
+	// the hooks appended by the tenant Adapter do not overwrite the others.
+	tenant.writeHooks = p.writeHooks[:len(p.writeHooks):len(p.writeHooks)]
+
+	tenant.genModeSQL()
+
+	return &tenant, nil
+}
@@ -15,14 +15,23 @@
 package sqlxadaptertest
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/casbin/casbin/v3"
 	"github.com/casbin/casbin/v3/util"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 
 	. "github.com/Blank-Xu/sqlx-adapter"
+	"github.com/Blank-Xu/sqlx-adapter/pqnotify"
 )
 
 const (
@@ -54,6 +63,90 @@ func TestAdapters(t *testing.T) {
 		// testSQL(t, db, "sqlxadapter_sql")
 		// t.Log("---------- testSQL finished")
 
+		t.Log("---------- testDialect start")
+		testDialect(t, db, "sqlxadapter_dialect")
+		t.Log("---------- testDialect finished")
+
+		t.Log("---------- testIndexes start")
+		testIndexes(t, db, "sqlxadapter_indexes")
+		t.Log("---------- testIndexes finished")
+
+		t.Log("---------- testRetryPolicy start")
+		testRetryPolicy(t, db, "sqlxadapter_retry_policy")
+		t.Log("---------- testRetryPolicy finished")
+
+		t.Log("---------- testErrors start")
+		testErrors(t, db, "sqlxadapter_errors")
+		t.Log("---------- testErrors finished")
+
+		t.Log("---------- testStrict start")
+		testStrict(t, db, "sqlxadapter_strict")
+		t.Log("---------- testStrict finished")
+
+		t.Log("---------- testStrictHooks start")
+		testStrictHooks(t, db, "sqlxadapter_strict_hooks")
+		t.Log("---------- testStrictHooks finished")
+
+		t.Log("---------- testRemoveFilteredPolicyReturning start")
+		testRemoveFilteredPolicyReturning(t, db, "sqlxadapter_remove_returning")
+		t.Log("---------- testRemoveFilteredPolicyReturning finished")
+
+		t.Log("---------- testWipeGuard start")
+		testWipeGuard(t, db, "sqlxadapter_wipe_guard")
+		t.Log("---------- testWipeGuard finished")
+
+		t.Log("---------- testBatchInsert start")
+		testBatchInsert(t, db, "sqlxadapter_batch_insert")
+		t.Log("---------- testBatchInsert finished")
+
+		t.Log("---------- testStmtCache start")
+		testStmtCache(t, db, "sqlxadapter_stmt_cache")
+		t.Log("---------- testStmtCache finished")
+
+		t.Log("---------- testWatcher start")
+		testWatcher(t, db, "sqlxadapter_watcher")
+		t.Log("---------- testWatcher finished")
+
+		t.Log("---------- testChangelogWatcher start")
+		testChangelogWatcher(t, db, "sqlxadapter_changelog")
+		t.Log("---------- testChangelogWatcher finished")
+
+		t.Log("---------- testWatcherErrors start")
+		testWatcherErrors(t, db, "sqlxadapter_watcher_errors")
+		t.Log("---------- testWatcherErrors finished")
+
+		t.Log("---------- testNotifyWatcher start")
+		testNotifyWatcher(t, db, testDataSources[driverName], "sqlxadapter_notify")
+		t.Log("---------- testNotifyWatcher finished")
+
+		t.Log("---------- testAudit start")
+		testAudit(t, db, "sqlxadapter_audit")
+		t.Log("---------- testAudit finished")
+
+		t.Log("---------- testHistory start")
+		testHistory(t, db, "sqlxadapter_history")
+		t.Log("---------- testHistory finished")
+
+		t.Log("---------- testSnapshot start")
+		testSnapshot(t, db, "sqlxadapter_snapshot")
+		t.Log("---------- testSnapshot finished")
+
+		t.Log("---------- testSoftDelete start")
+		testSoftDelete(t, db, "sqlxadapter_soft_delete")
+		t.Log("---------- testSoftDelete finished")
+
+		t.Log("---------- testExpiry start")
+		testExpiry(t, db, "sqlxadapter_expiry")
+		t.Log("---------- testExpiry finished")
+
+		t.Log("---------- testTenant start")
+		testTenant(t, db, "sqlxadapter_tenant")
+		t.Log("---------- testTenant finished")
+
+		t.Log("---------- testTenantIndexes start")
+		testTenantIndexes(t, db, "sqlxadapter_tenant_indexes")
+		t.Log("---------- testTenantIndexes finished")
+
 		t.Log("---------- testSaveLoad start")
 		testSaveLoad(t, db, "sqlxadapter_save_load")
 		t.Log("---------- testSaveLoad finished")
@@ -202,192 +295,2128 @@ func initPolicy(t *testing.T, db *sqlx.DB, tableName string) {
 	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
 }
 
-func testSaveLoad(t *testing.T, db *sqlx.DB, tableName string) {
-	// Initialize some policy in DB.
-	initPolicy(t, db, tableName)
-	// Note: you don't need to look at the above code
-	// if you already have a working DB with policy inside.
+func testDialect(t *testing.T, db *sqlx.DB, tableName string) {
+	_, err := NewAdapter(db, tableName, WithDialect("unknown"))
+	if err == nil {
+		t.Error("NewAdapter with invalid dialect test failed, err is nil")
+	}
 
-	// Now the DB has policy, so we can provide a normal use case.
-	// Create an adapter and an enforcer.
-	// NewEnforcer() will load the policy automatically.
-	a, _ := NewAdapter(db, tableName)
-	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
-}
+	// an unknown driver name, the dialect is detected by the driver type.
+	wrappedDB := sqlx.NewDb(db.DB, "wrapped_"+db.DriverName())
 
-func testAutoSave(t *testing.T, db *sqlx.DB, tableName string) {
-	// Initialize some policy in DB.
-	initPolicy(t, db, tableName)
-	// Note: you don't need to look at the above code
-	// if you already have a working DB with policy inside.
+	a, err := NewAdapter(wrappedDB, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter with wrapped db test failed, err: ", err)
+	}
 
-	// Now the DB has policy, so we can provide a normal use case.
-	// Create an adapter and an enforcer.
-	// NewEnforcer() will load the policy automatically.
-	a, _ := NewAdapter(db, tableName)
-	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	e, _ := casbin.NewEnforcer(testRbacModelFile, testRbacPolicyFile)
+	if err = a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatal("SavePolicy with wrapped db test failed, err: ", err)
+	}
 
-	// AutoSave is enabled by default.
-	// Now we disable it.
-	e.EnableAutoSave(false)
+	e, _ = casbin.NewEnforcer(testRbacModelFile, a)
+	if _, err = e.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); err != nil {
+		t.Error("UpdatePolicy with wrapped db test failed, err: ", err)
+	}
 
-	var err error
-	logErr := func(action string) {
-		if err != nil {
-			t.Errorf("%s test failed, err: %v", action, err)
-		}
+	if err = e.LoadPolicy(); err != nil {
+		t.Error("LoadPolicy with wrapped db test failed, err: ", err)
 	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "write"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+}
 
-	// Because AutoSave is disabled, the policy change only affects the policy in Casbin enforcer,
-	// it doesn't affect the policy in the storage.
-	_, err = e.AddPolicy("alice", "data1", "write")
-	logErr("AddPolicy1")
-	// Reload the policy from the storage to see the effect.
-	err = e.LoadPolicy()
-	logErr("LoadPolicy1")
-	// This is still the original policy.
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+func testIndexes(t *testing.T, db *sqlx.DB, tableName string) {
+	_, err := NewAdapter(db, tableName, WithIndexes(Index{Columns: []string{"v6"}}))
+	if err == nil {
+		t.Error("NewAdapter with invalid index column test failed, err is nil")
+	}
 
-	_, err = e.AddPolicies([][]string{{"alice_1", "data_1", "read_1"}, {"bob_1", "data_1", "write_1"}})
-	logErr("AddPolicies1")
-	// Reload the policy from the storage to see the effect.
-	err = e.LoadPolicy()
-	logErr("LoadPolicy2")
-	// This is still the original policy.
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	_, err = NewAdapter(db, tableName, WithIndexes(Index{Name: "idx; DROP TABLE x", Columns: []string{"v0"}}))
+	if err == nil {
+		t.Error("NewAdapter with invalid index name test failed, err is nil")
+	}
 
-	// Now we enable the AutoSave.
-	e.EnableAutoSave(true)
+	// the key exceeds the 3072 bytes of MySQL, it is checked before the table is created.
+	_, err = NewAdapter(db, tableName, WithDialect(DialectMysql), WithIndexes(
+		Index{Columns: []string{"p_type", "v0", "v1", "v2", "v3", "v4", "v5"}, Unique: true},
+	))
+	if err == nil {
+		t.Error("NewAdapter with too long index key test failed, err is nil")
+	}
 
-	// Because AutoSave is enabled, the policy change not only affects the policy in Casbin enforcer,
-	// but also affects the policy in the storage.
-	_, err = e.AddPolicy("alice", "data1", "write")
-	logErr("AddPolicy2")
-	// Reload the policy from the storage to see the effect.
-	err = e.LoadPolicy()
-	logErr("LoadPolicy3")
-	// The policy has a new rule: {"alice", "data1", "write"}.
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"alice", "data1", "write"}})
+	a, err := NewAdapter(db, tableName, WithIndexes(
+		Index{Columns: []string{"v1"}},
+		Index{Columns: []string{"v2"}},
+		Index{Columns: []string{"p_type", "v0", "v2"}, Unique: true},
+	))
+	if err != nil {
+		t.Fatal("NewAdapter with indexes test failed, err: ", err)
+	}
 
-	_, err = e.AddPolicies([][]string{{"alice_2", "data_2", "read_2"}, {"bob_2", "data_2", "write_2"}})
-	logErr("AddPolicies2")
-	// Reload the policy from the storage to see the effect.
-	err = e.LoadPolicy()
-	logErr("LoadPolicy4")
-	// This is still the original policy.
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"alice", "data1", "write"},
-		{"alice_2", "data_2", "read_2"}, {"bob_2", "data_2", "write_2"}})
+	e, _ := casbin.NewEnforcer(testRbacModelFile, testRbacPolicyFile)
+	if err = a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatal("SavePolicy test failed, err: ", err)
+	}
 
-	_, err = e.RemovePolicies([][]string{{"alice_2", "data_2", "read_2"}, {"bob_2", "data_2", "write_2"}})
-	logErr("RemovePolicies")
-	err = e.LoadPolicy()
-	logErr("LoadPolicy5")
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"alice", "data1", "write"}})
+	// conflicts with {"alice", "data1", "read"} in the unique index.
+	if err = a.AddPolicy("p", "p", []string{"alice", "data2", "read"}); !errors.Is(err, ErrDuplicate) {
+		t.Error("AddPolicy with unique index test failed, err: ", err)
+	}
 
-	// Remove the added rule.
-	_, err = e.RemovePolicy("alice", "data1", "write")
-	logErr("RemovePolicy")
-	err = e.LoadPolicy()
-	logErr("LoadPolicy6")
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	// the hash of all the rule columns is indexed on MySQL and SQLServer, the columns are indexed on the others.
+	ha, err := NewAdapter(db, tableName+"_hash", WithIndexes(
+		Index{Columns: []string{"p_type", "v0", "v1", "v2", "v3", "v4", "v5"}, Unique: true, Hash: true},
+	))
+	if err != nil {
+		t.Fatal("NewAdapter with unique hash index test failed, err: ", err)
+	}
 
-	// Remove "data2_admin" related policy rules via a filter.
-	// Two rules: {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"} are deleted.
-	_, err = e.RemoveFilteredPolicy(0, "data2_admin")
-	logErr("RemoveFilteredPolicy")
-	err = e.LoadPolicy()
-	logErr("LoadPolicy7")
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+	if err = ha.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"alice", "data1", "read", "deny"}}); err != nil {
+		t.Error("AddPolicies with unique hash index test failed, err: ", err)
+	}
+
+	if err = ha.AddPolicy("p", "p", []string{"alice", "data1", "read"}); !errors.Is(err, ErrDuplicate) {
+		t.Error("AddPolicy with unique hash index test failed, err: ", err)
+	}
 }
 
-func testFilteredPolicy(t *testing.T, db *sqlx.DB, tableName string) {
-	// Initialize some policy in DB.
-	initPolicy(t, db, tableName)
-	// Note: you don't need to look at the above code
-	// if you already have a working DB with policy inside.
+func testRetryPolicy(t *testing.T, db *sqlx.DB, tableName string) {
+	var classified int
+
+	a, err := NewAdapter(db, tableName, WithRetryPolicy(RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+		Jitter:      0.5,
+		Classifier: func(err error) bool {
+			classified++
+			return true
+		},
+	}))
+	if err != nil {
+		t.Fatal("NewAdapter with retry policy test failed, err: ", err)
+	}
 
-	// Now the DB has policy, so we can provide a normal use case.
-	// Create an adapter and an enforcer.
-	// NewEnforcer() will load the policy automatically.
-	a, _ := NewAdapter(db, tableName)
-	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
-	// Now set the adapter
-	e.SetAdapter(a)
+	// the table is missing, it fails on every attempt.
+	if _, err = db.Exec("DROP TABLE " + tableName); err != nil {
+		t.Fatal("drop table failed, err: ", err)
+	}
 
-	var err error
-	logErr := func(action string) {
-		if err != nil {
-			t.Errorf("%s test failed, err: %v", action, err)
-		}
+	rules := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}
+	if err = a.AddPolicies("p", "p", rules); err == nil {
+		t.Fatal("AddPolicies with retry policy test failed, err is nil")
 	}
 
-	// Load only alice's policies
-	err = e.LoadFilteredPolicy(&Filter{V0: []string{"alice"}})
-	logErr("LoadFilteredPolicy alice")
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+	if classified != 2 {
+		t.Errorf("AddPolicies with retry policy test failed, classified: %d, supposed to be 2", classified)
+	}
 
-	// Load only bob's policies
-	err = e.LoadFilteredPolicy(&Filter{V0: []string{"bob"}})
-	logErr("LoadFilteredPolicy bob")
-	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}})
+	// the driver errors are wrapped by the rule and the operation, the default classifier checks the innermost error.
+	wrap := func(err error) error {
+		return &OpError{Op: "AddPolicies", Table: tableName, Err: &OpError{Rule: []string{"p", "alice"}, Err: err}}
+	}
 
-	// Load policies for data2_admin
-	err = e.LoadFilteredPolicy(&Filter{V0: []string{"data2_admin"}})
-	logErr("LoadFilteredPolicy data2_admin")
-	testGetPolicy(t, e, [][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	if !DialectMysql.IsRetryable(wrap(&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"})) {
+		t.Error("IsRetryable with wrapped MySQL deadlock test failed, supposed to be retryable")
+	}
 
-	// Load policies for alice and bob
-	err = e.LoadFilteredPolicy(&Filter{V0: []string{"alice", "bob"}})
-	logErr("LoadFilteredPolicy alice bob")
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+	if !DialectMysql.IsRetryable(wrap(&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"})) {
+		t.Error("IsRetryable with wrapped MySQL lock wait timeout test failed, supposed to be retryable")
+	}
 
-	_, err = e.AddPolicy("bob", "data2", "read")
-	logErr("AddPolicy")
+	if DialectMysql.IsRetryable(wrap(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})) {
+		t.Error("IsRetryable with wrapped MySQL duplicate entry test failed, supposed to be not retryable")
+	}
 
-	err = e.LoadFilteredPolicy(&filter)
-	logErr("LoadFilteredPolicy filter")
-	testGetPolicy(t, e, [][]string{{"bob", "data2", "read"}})
+	// CockroachDB requires the clients to retry the serialization errors, the code is checked by SQLState.
+	if !DialectCockroach.IsRetryable(wrap(&pq.Error{Code: "40001", Message: "restart transaction"})) {
+		t.Error("IsRetryable with wrapped CockroachDB serialization failure test failed, supposed to be retryable")
+	}
+
+	if DialectCockroach.IsRetryable(wrap(&pq.Error{Code: "23505", Message: "duplicate key value"})) {
+		t.Error("IsRetryable with wrapped CockroachDB unique violation test failed, supposed to be not retryable")
+	}
+
+	// the statement or the COMMIT may have been executed before the connection is lost, only driver.ErrBadConn is replayed.
+	for _, dialect := range []Dialect{DialectMysql, DialectPostgres, DialectCockroach, DialectSqlserver, DialectSqlite3, DialectOracle, DialectGeneric} {
+		if dialect.IsRetryable(wrap(io.ErrUnexpectedEOF)) {
+			t.Errorf("IsRetryable with wrapped unexpected EOF test failed, dialect: %s, supposed to be not retryable", dialect)
+		}
+
+		if dialect.IsRetryable(wrap(errors.New("write tcp 127.0.0.1:3306: broken pipe"))) {
+			t.Errorf("IsRetryable with wrapped broken pipe test failed, dialect: %s, supposed to be not retryable", dialect)
+		}
+
+		if !dialect.IsRetryable(wrap(driver.ErrBadConn)) {
+			t.Errorf("IsRetryable with wrapped driver.ErrBadConn test failed, dialect: %s, supposed to be retryable", dialect)
+		}
+	}
 }
 
-func testUpdatePolicy(t *testing.T, db *sqlx.DB, tableName string) {
-	// Initialize some policy in DB.
-	initPolicy(t, db, tableName)
+func testErrors(t *testing.T, db *sqlx.DB, tableName string) {
+	a, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	err = a.AddPolicy("p", "p", []string{"a", "b", "c", "d", "e", "f", "g"})
+	if !errors.Is(err, ErrRuleTooLong) {
+		t.Error("AddPolicy with too long rule test failed, err: ", err)
+	}
+
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "AddPolicy" || opErr.Table != tableName || len(opErr.Rule) != 8 {
+		t.Errorf("AddPolicy OpError test failed, err: %#v", opErr)
+	}
+
+	err = a.UpdatePolicies("p", "p", [][]string{{"alice", "data1", "read"}}, nil)
+	if !errors.Is(err, ErrRuleCountMismatch) {
+		t.Error("UpdatePolicies with mismatched rules test failed, err: ", err)
+	}
 
-	a, _ := NewAdapter(db, tableName)
 	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
 
-	e.EnableAutoSave(true)
-	e.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1", "write"})
-	e.LoadPolicy()
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "write"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	if err = a.LoadFilteredPolicy(e.GetModel(), Filter{}); !errors.Is(err, ErrInvalidFilter) {
+		t.Error("LoadFilteredPolicy with invalid filter type test failed, err: ", err)
+	}
+
+	if err = a.LoadFilteredPolicy(e.GetModel(), &Filter{}); !errors.Is(err, ErrInvalidFilter) {
+		t.Error("LoadFilteredPolicy with empty filter test failed, err: ", err)
+	}
+
+	if _, err = db.Exec("DROP TABLE " + tableName); err != nil {
+		t.Fatal("drop table failed, err: ", err)
+	}
+
+	if err = a.LoadPolicy(e.GetModel()); !errors.Is(err, ErrTableMissing) {
+		t.Error("LoadPolicy with missing table test failed, err: ", err)
+	}
 }
 
-func testUpdatePolicies(t *testing.T, db *sqlx.DB, tableName string) {
-	// Initialize some policy in DB.
+func testStrict(t *testing.T, db *sqlx.DB, tableName string) {
 	initPolicy(t, db, tableName)
 
-	a, _ := NewAdapter(db, tableName)
-	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	a, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
 
-	e.EnableAutoSave(true)
-	e.UpdatePolicies([][]string{{"alice", "data1", "write"}, {"bob", "data2", "write"}}, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "read"}})
-	e.LoadPolicy()
-	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	// lenient by default.
+	if err = a.RemovePolicy("p", "p", []string{"alice", "data9", "read"}); err != nil {
+		t.Error("RemovePolicy with missing rule in lenient mode test failed, err: ", err)
+	}
+
+	affected, err := a.RemovePoliciesAffected(context.Background(), "p", "p", [][]string{{"alice", "data1", "read"}, {"alice", "data9", "read"}})
+	if err != nil || affected != 1 {
+		t.Errorf("RemovePoliciesAffected test failed, affected: %d, err: %v", affected, err)
+	}
+
+	affected, err = a.RemoveFilteredPolicyAffected(context.Background(), "p", "p", 0, "data2_admin")
+	if err != nil || affected != 2 {
+		t.Errorf("RemoveFilteredPolicyAffected test failed, affected: %d, err: %v", affected, err)
+	}
+
+	a, err = NewAdapter(db, tableName, WithStrict(true))
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	if err = a.RemovePolicy("p", "p", []string{"alice", "data1", "read"}); !errors.Is(err, ErrNotFound) {
+		t.Error("RemovePolicy with missing rule in strict mode test failed, err: ", err)
+	}
+
+	if err = a.RemoveFilteredPolicy("p", "p", 0, "data2_admin"); !errors.Is(err, ErrNotFound) {
+		t.Error("RemoveFilteredPolicy with missing rule in strict mode test failed, err: ", err)
+	}
+
+	if err = a.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); !errors.Is(err, ErrNotFound) {
+		t.Error("UpdatePolicy with missing rule in strict mode test failed, err: ", err)
+	}
+
+	// the transaction is rolled back, bob's rule is not updated.
+	err = a.UpdatePolicies("p", "p",
+		[][]string{{"bob", "data2", "write"}, {"alice", "data1", "read"}},
+		[][]string{{"bob", "data2", "read"}, {"alice", "data1", "write"}})
+
+	var opErr *OpError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &opErr) || len(opErr.Rule) != 4 || opErr.Rule[1] != "alice" {
+		t.Error("UpdatePolicies with missing rule in strict mode test failed, err: ", err)
+	}
+
+	affected, err = a.RemovePoliciesAffected(context.Background(), "p", "p", [][]string{{"bob", "data2", "write"}})
+	if err != nil || affected != 1 {
+		t.Errorf("RemovePoliciesAffected in strict mode test failed, affected: %d, err: %v", affected, err)
+	}
 }
 
-func testUpdateFilteredPolicies(t *testing.T, db *sqlx.DB, tableName string) {
-	// Initialize some policy in DB.
+func testStrictHooks(t *testing.T, db *sqlx.DB, tableName string) {
 	initPolicy(t, db, tableName)
 
-	a, _ := NewAdapter(db, tableName)
-	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	a, err := NewAdapter(db, tableName, WithStrict(true), WithAudit(), WithChangelog())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
 
-	e.EnableAutoSave(true)
-	e.UpdateFilteredPolicies([][]string{{"alice", "data1", "write"}}, 0, "alice", "data1", "read")
-	e.UpdateFilteredPolicies([][]string{{"bob", "data2", "read"}}, 0, "bob", "data2", "write")
-	e.LoadPolicy()
-	testGetPolicyWithoutOrder(t, e, [][]string{{"alice", "data1", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"bob", "data2", "read"}})
+	ctx := context.Background()
+
+	// state  get the version, the count of the change log and the audit entries.
+	state := func() [3]int {
+		var version, changes int
+
+		if err := db.Get(&version, "SELECT version FROM "+tableName+"_version WHERE id=1"); err != nil {
+			t.Fatal("select version failed, err: ", err)
+		}
+
+		if err := db.Get(&changes, "SELECT COUNT(*) FROM "+tableName+"_changelog"); err != nil {
+			t.Fatal("select change log failed, err: ", err)
+		}
+
+		entries, err := a.ListAudit(ctx, AuditQuery{})
+		if err != nil {
+			t.Fatal("ListAudit test failed, err: ", err)
+		}
+
+		return [3]int{version, changes, len(entries)}
+	}
+
+	if err = a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+
+	before := state()
+
+	// the rejected writes are rolled back with the version, the change log and the audit.
+	if err = a.RemovePolicy("p", "p", []string{"alice", "data9", "read"}); !errors.Is(err, ErrNotFound) {
+		t.Error("RemovePolicy with missing rule in strict mode test failed, err: ", err)
+	}
+
+	if err = a.UpdatePolicy("p", "p", []string{"alice", "data9", "read"}, []string{"alice", "data9", "write"}); !errors.Is(err, ErrNotFound) {
+		t.Error("UpdatePolicy with missing rule in strict mode test failed, err: ", err)
+	}
+
+	if err = a.RemoveFilteredPolicy("p", "p", 0, "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Error("RemoveFilteredPolicy with missing rule in strict mode test failed, err: ", err)
+	}
+
+	if after := state(); after != before {
+		t.Errorf("the rejected writes in strict mode test failed, [version changelog audit] before: %v, after: %v", before, after)
+	}
+
+	// the writes which affect nothing in lenient mode do not record any change.
+	lenient, err := NewAdapter(db, tableName, WithAudit(), WithChangelog())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	if err = lenient.RemovePolicy("p", "p", []string{"alice", "data9", "read"}); err != nil {
+		t.Error("RemovePolicy with missing rule in lenient mode test failed, err: ", err)
+	}
+
+	if err = lenient.RemovePolicies("p", "p", [][]string{{"alice", "data9", "read"}, {"bob", "data9", "read"}}); err != nil {
+		t.Error("RemovePolicies with missing rules in lenient mode test failed, err: ", err)
+	}
+
+	if err = lenient.UpdatePolicy("p", "p", []string{"alice", "data9", "read"}, []string{"alice", "data9", "write"}); err != nil {
+		t.Error("UpdatePolicy with missing rule in lenient mode test failed, err: ", err)
+	}
+
+	if err = lenient.RemoveFilteredPolicy("p", "p", 0, "nobody"); err != nil {
+		t.Error("RemoveFilteredPolicy with missing rule in lenient mode test failed, err: ", err)
+	}
+
+	if after := state(); after != before {
+		t.Errorf("the writes without change in lenient mode test failed, [version changelog audit] before: %v, after: %v", before, after)
+	}
+
+	// the applied write is still recorded.
+	if err = a.RemovePolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatal("RemovePolicy test failed, err: ", err)
+	}
+
+	if after := state(); after[0] != before[0]+1 || after[1] != before[1]+1 || after[2] != before[2]+1 {
+		t.Errorf("RemovePolicy test failed, [version changelog audit] before: %v, after: %v", before, after)
+	}
+}
+
+func testRemoveFilteredPolicyReturning(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	a, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	rules, err := a.RemoveFilteredPolicyReturning(context.Background(), "p", "p", 0, "data2_admin")
+	if err != nil {
+		t.Fatal("RemoveFilteredPolicyReturning test failed, err: ", err)
+	}
+
+	// the rules start with the ptype, the same as UpdateFilteredPolicies.
+	if !arrayEqualsWithoutOrder(rules, [][]string{{"p", "data2_admin", "data2", "read"}, {"p", "data2_admin", "data2", "write"}}) {
+		t.Error("RemoveFilteredPolicyReturning test failed, rules: ", rules)
+	}
+
+	rules, err = a.RemoveFilteredPolicyReturning(context.Background(), "p", "p", 1, "data9")
+	if err != nil || len(rules) != 0 {
+		t.Errorf("RemoveFilteredPolicyReturning with missing rule test failed, rules: %v, err: %v", rules, err)
+	}
+
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+}
+
+func testWipeGuard(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	a, err := NewAdapter(db, tableName, WithWipeGuard("g"))
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	if err = a.RemoveFilteredPolicy("p", "p", -1, "alice"); !errors.Is(err, ErrInvalidFieldIndex) {
+		t.Error("RemoveFilteredPolicy with negative field index test failed, err: ", err)
+	}
+
+	if err = a.RemoveFilteredPolicy("p", "p", 5, "read", "write"); !errors.Is(err, ErrInvalidFieldIndex) {
+		t.Error("RemoveFilteredPolicy with out of range field values test failed, err: ", err)
+	}
+
+	if err = a.RemoveFilteredPolicy("p", "p", 6); !errors.Is(err, ErrInvalidFieldIndex) {
+		t.Error("RemoveFilteredPolicy with out of range field index test failed, err: ", err)
+	}
+
+	if _, err = a.UpdateFilteredPolicies("p", "p", nil, 6, "read"); !errors.Is(err, ErrInvalidFieldIndex) {
+		t.Error("UpdateFilteredPolicies with out of range field index test failed, err: ", err)
+	}
+
+	if err = a.RemoveFilteredPolicy("p", "p", 0, "", ""); !errors.Is(err, ErrWipeRefused) {
+		t.Error("RemoveFilteredPolicy with empty field values test failed, err: ", err)
+	}
+
+	if _, err = a.UpdateFilteredPolicies("p", "p", [][]string{{"alice", "data1", "write"}}, 0); !errors.Is(err, ErrWipeRefused) {
+		t.Error("UpdateFilteredPolicies with empty field values test failed, err: ", err)
+	}
+
+	if err = a.RemoveFilteredPolicy("g", "g", 0); err != nil {
+		t.Error("RemoveFilteredPolicy with allowed ptype test failed, err: ", err)
+	}
+
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	if rules, _ := e.GetGroupingPolicy(); len(rules) != 0 {
+		t.Error("RemoveFilteredPolicy with allowed ptype test failed, grouping policy: ", rules)
+	}
+}
+
+func testBatchInsert(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	// PostgreSQL with github.com/lib/pq inserts the rules by "COPY FROM STDIN".
+	a, err := NewAdapter(db, tableName, WithCopyThreshold(500))
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	rules := make([][]string, 0, 1000)
+	for idx := 0; idx < cap(rules); idx++ {
+		rules = append(rules, []string{"user" + strconv.Itoa(idx), "data" + strconv.Itoa(idx%10), "read"})
+	}
+
+	if err = a.AddPolicies("p", "p", rules); err != nil {
+		t.Fatal("AddPolicies test failed, err: ", err)
+	}
+
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	if policy, _ := e.GetPolicy(); len(policy) != len(rules)+4 {
+		t.Fatalf("AddPolicies test failed, policy count: %d", len(policy))
+	}
+
+	if ok, _ := e.Enforce("user999", "data9", "read"); !ok {
+		t.Error("AddPolicies test failed, the last rule is not found")
+	}
+
+	if err = a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatal("SavePolicy test failed, err: ", err)
+	}
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+
+	if policy, _ := e.GetPolicy(); len(policy) != len(rules)+4 {
+		t.Errorf("SavePolicy test failed, policy count: %d", len(policy))
+	}
+	// the missing rule is ignored in the lenient mode.
+	affected, err := a.RemovePoliciesAffected(context.Background(), "p", "p", append(rules, []string{"alice", "data9", "read"}))
+	if err != nil || affected != int64(len(rules)) {
+		t.Fatalf("RemovePoliciesAffected test failed, affected: %d, err: %v", affected, err)
+	}
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	// the long rules exceed the packet size of MySQL in one batch, they are split by the estimated bytes.
+	if db.DriverName() != "mysql" {
+		return
+	}
+
+	padding := strings.Repeat("x", 240)
+
+	longRules := make([][]string, 0, 4000)
+	for idx := 0; idx < cap(longRules); idx++ {
+		suffix := strconv.Itoa(idx)
+		longRules = append(longRules, []string{padding + "u" + suffix, padding + "d" + suffix, padding + "a" + suffix})
+	}
+
+	if err = a.AddPolicies("p", "p", longRules); err != nil {
+		t.Fatal("AddPolicies with long rules test failed, err: ", err)
+	}
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+
+	if policy, _ := e.GetPolicy(); len(policy) != len(longRules)+4 {
+		t.Errorf("AddPolicies with long rules test failed, policy count: %d", len(policy))
+	}
+
+	affected, err = a.RemovePoliciesAffected(context.Background(), "p", "p", longRules)
+	if err != nil || affected != int64(len(longRules)) {
+		t.Errorf("RemovePoliciesAffected with long rules test failed, affected: %d, err: %v", affected, err)
+	}
+}
+
+func testStmtCache(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	a, err := NewAdapter(db, tableName, WithStmtCache(true), WithStrict(true))
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+
+	// the cached statements are reused by the repeated calls.
+	for idx := 0; idx < 2; idx++ {
+		if _, err = e.AddPolicy("carol", "data3", "read"); err != nil {
+			t.Fatal("AddPolicy test failed, err: ", err)
+		}
+
+		if _, err = e.UpdatePolicy([]string{"carol", "data3", "read"}, []string{"carol", "data3", "write"}); err != nil {
+			t.Fatal("UpdatePolicy test failed, err: ", err)
+		}
+
+		if _, err = e.RemovePolicies([][]string{{"carol", "data3", "write"}}); err != nil {
+			t.Fatal("RemovePolicies test failed, err: ", err)
+		}
+	}
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	if err = a.Close(context.Background()); err != nil {
+		t.Fatal("Close test failed, err: ", err)
+	}
+
+	if err = a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); !errors.Is(err, ErrClosed) {
+		t.Error("AddPolicy after Close test failed, err: ", err)
+	}
+
+	if err = a.Close(context.Background()); err != nil {
+		t.Error("Close twice test failed, err: ", err)
+	}
+
+	// the db is owned by the user and still open.
+	if err = db.Ping(); err != nil {
+		t.Error("Close test failed, db is closed, err: ", err)
+	}
+}
+
+func testWatcher(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	a, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer a.Close(context.Background())
+
+	if _, err = NewWatcher(a, 20*time.Millisecond); !errors.Is(err, ErrVersionDisabled) {
+		t.Error("NewWatcher without version test failed, err: ", err)
+	}
+
+	// the instance A writes the policy, it bumps the version without a watcher.
+	a1, err := NewAdapter(db, tableName, WithVersion())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer a1.Close(context.Background())
+
+	e1, _ := casbin.NewEnforcer(testRbacModelFile, a1)
+
+	// the instance B is notified.
+	a2, err := NewAdapter(db, tableName, WithVersion())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer a2.Close(context.Background())
+
+	w2, err := NewWatcher(a2, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal("NewWatcher test failed, err: ", err)
+	}
+
+	e2, _ := casbin.NewEnforcer(testRbacModelFile, a2)
+
+	updated := make(chan string, 16)
+	if err = w2.SetUpdateCallback(func(version string) {
+		_ = e2.LoadPolicy()
+		updated <- version
+	}); err != nil {
+		t.Fatal("SetUpdateCallback test failed, err: ", err)
+	}
+
+	if _, err = e1.AddPolicy("carol", "data3", "read"); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher test failed, the update callback is not called")
+	}
+
+	if ok, _ := e2.Enforce("carol", "data3", "read"); !ok {
+		t.Error("Watcher test failed, the policy is not reloaded")
+	}
+
+	// the failed write does not bump the version.
+	if err = a1.AddPolicy("p", "p", []string{"a", "b", "c", "d", "e", "f", "g"}); !errors.Is(err, ErrRuleTooLong) {
+		t.Error("AddPolicy with too long rule test failed, err: ", err)
+	}
+
+	select {
+	case version := <-updated:
+		t.Error("Watcher test failed, the update callback is called without changes, version: ", version)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the callback is not called after Close.
+	w2.Close()
+
+	if _, err = e1.RemovePolicy("carol", "data3", "read"); err != nil {
+		t.Fatal("RemovePolicy test failed, err: ", err)
+	}
+
+	select {
+	case version := <-updated:
+		t.Error("Watcher test failed, the update callback is called after Close, version: ", version)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func testChangelogWatcher(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	a0, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	if _, err = NewChangelogWatcher(a0, 0); !errors.Is(err, ErrChangelogDisabled) {
+		t.Error("NewChangelogWatcher without changelog test failed, err: ", err)
+	}
+
+	// the instance A writes the policy.
+	a1, err := NewAdapter(db, tableName, WithChangelog())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer a1.Close(context.Background())
+
+	e1, _ := casbin.NewEnforcer(testRbacModelFile, a1)
+
+	// the instance B applies the changes of the instance A.
+	a2, err := NewAdapter(db, tableName, WithChangelog())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer a2.Close(context.Background())
+
+	w2, err := NewChangelogWatcher(a2, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal("NewChangelogWatcher test failed, err: ", err)
+	}
+
+	e2, _ := casbin.NewEnforcer(testRbacModelFile, a2)
+	if err = e2.SetWatcher(w2); err != nil {
+		t.Fatal("SetWatcher test failed, err: ", err)
+	}
+
+	changes := make(chan Change, 16)
+	w2.SetChangeCallback(func(c Change) {
+		if err := ApplyChange(e2, c); err != nil {
+			t.Error("ApplyChange test failed, err: ", err)
+		}
+		changes <- c
+	})
+
+	waitChanges := func(n int) []Change {
+		list := make([]Change, 0, n)
+		for len(list) < n {
+			select {
+			case c := <-changes:
+				list = append(list, c)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("ChangelogWatcher test failed, got %d changes, want %d", len(list), n)
+			}
+		}
+		return list
+	}
+
+	ctx := WithActor(context.Background(), "admin")
+	if err = a1.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatal("AddPolicyCtx test failed, err: ", err)
+	}
+
+	c := waitChanges(1)[0]
+	if c.Op != OpAddPolicy || c.PType != "p" || c.Actor != "admin" || !util.ArrayEquals(c.Rule, []string{"carol", "data3", "read"}) {
+		t.Errorf("ChangelogWatcher test failed, change: %+v", c)
+	}
+	if ok, _ := e2.Enforce("carol", "data3", "read"); !ok {
+		t.Error("ChangelogWatcher test failed, the added policy is not applied")
+	}
+
+	if err = a1.UpdatePolicies("p", "p", [][]string{{"carol", "data3", "read"}}, [][]string{{"carol", "data3", "write"}}); err != nil {
+		t.Fatal("UpdatePolicies test failed, err: ", err)
+	}
+
+	c = waitChanges(1)[0]
+	if c.Op != OpUpdatePolicy || c.Actor != "" || !util.ArrayEquals(c.OldRule, []string{"carol", "data3", "read"}) {
+		t.Errorf("ChangelogWatcher test failed, change: %+v", c)
+	}
+	if ok, _ := e2.Enforce("carol", "data3", "write"); !ok {
+		t.Error("ChangelogWatcher test failed, the updated policy is not applied")
+	}
+
+	// the changes of one transaction have the same sequence number.
+	if _, err = e1.AddGroupingPolicies([][]string{{"carol", "data2_admin"}, {"dave", "data2_admin"}}); err != nil {
+		t.Fatal("AddGroupingPolicies test failed, err: ", err)
+	}
+
+	list := waitChanges(2)
+	if list[0].Seq != list[1].Seq || list[0].Index != 0 || list[1].Index != 1 || list[1].Sec != "g" {
+		t.Errorf("ChangelogWatcher test failed, changes: %+v", list)
+	}
+	if ok, _ := e2.Enforce("dave", "data2", "read"); !ok {
+		t.Error("ChangelogWatcher test failed, the role links are not applied")
+	}
+
+	if err = a1.RemoveFilteredPolicy("p", "p", 0, "carol"); err != nil {
+		t.Fatal("RemoveFilteredPolicy test failed, err: ", err)
+	}
+
+	c = waitChanges(1)[0]
+	if c.Op != OpRemoveFilteredPolicy || c.FieldIndex != 0 || !util.ArrayEquals(c.Rule, []string{"carol"}) {
+		t.Errorf("ChangelogWatcher test failed, change: %+v", c)
+	}
+	if ok, _ := e2.Enforce("carol", "data3", "write"); ok {
+		t.Error("ChangelogWatcher test failed, the removed policy is not applied")
+	}
+
+	// the changes of the instance itself are skipped.
+	if err = a2.AddPolicy("p", "p", []string{"erin", "data4", "read"}); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+
+	select {
+	case c = <-changes:
+		t.Errorf("ChangelogWatcher test failed, the own change is applied: %+v", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err = a0.PurgeChangelog(context.Background(), 0); !errors.Is(err, ErrChangelogDisabled) {
+		t.Error("PurgeChangelog without changelog test failed, err: ", err)
+	}
+
+	// the recent changes are kept.
+	if purged, err := a1.PurgeChangelog(context.Background(), time.Hour); err != nil || purged != 0 {
+		t.Errorf("PurgeChangelog of the recent changes test failed, purged: %d, err: %v", purged, err)
+	}
+
+	var count int64
+	if err = db.Get(&count, "SELECT COUNT(*) FROM "+tableName+"_changelog"); err != nil {
+		t.Fatal("select changelog test failed, err: ", err)
+	}
+
+	if purged, err := a1.PurgeChangelog(context.Background(), 0); err != nil || purged != count || purged == 0 {
+		t.Errorf("PurgeChangelog test failed, purged: %d, supposed to be %d, err: %v", purged, count, err)
+	}
+
+	// the purge is not a change of the policy.
+	select {
+	case c = <-changes:
+		t.Errorf("PurgeChangelog test failed, the purge is passed as a change: %+v", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func testWatcherErrors(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	a, err := NewAdapter(db, tableName, WithChangelog())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer a.Close(context.Background())
+
+	w, err := NewWatcher(a, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal("NewWatcher test failed, err: ", err)
+	}
+
+	cw, err := NewChangelogWatcher(a, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal("NewChangelogWatcher test failed, err: ", err)
+	}
+
+	werrs := make(chan error, 64)
+	w.SetErrorCallback(func(err error) {
+		select {
+		case werrs <- err:
+		default:
+		}
+	})
+
+	cwerrs := make(chan error, 64)
+	cw.SetErrorCallback(func(err error) {
+		select {
+		case cwerrs <- err:
+		default:
+		}
+	})
+
+	// the change log is missing when the version is changed.
+	if _, err = db.Exec("DROP TABLE " + tableName + "_changelog"); err != nil {
+		t.Fatal("drop table failed, err: ", err)
+	}
+	if _, err = db.Exec("UPDATE " + tableName + "_version SET version=version+1 WHERE id=1"); err != nil {
+		t.Fatal("update version failed, err: ", err)
+	}
+
+	select {
+	case err = <-cwerrs:
+		var opErr *OpError
+		if !errors.As(err, &opErr) || opErr.Op != "ChangelogWatcher" {
+			t.Error("ChangelogWatcher error callback test failed, err: ", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ChangelogWatcher error callback test failed, the callback is not called")
+	}
+
+	select {
+	case err = <-werrs:
+		t.Error("Watcher error callback test failed, the version is polled, err: ", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the version is missing.
+	if _, err = db.Exec("DROP TABLE " + tableName + "_version"); err != nil {
+		t.Fatal("drop table failed, err: ", err)
+	}
+
+	select {
+	case err = <-werrs:
+		var opErr *OpError
+		if !errors.As(err, &opErr) || opErr.Op != "Watcher" {
+			t.Error("Watcher error callback test failed, err: ", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher error callback test failed, the callback is not called")
+	}
+}
+
+func testNotifyWatcher(t *testing.T, db *sqlx.DB, dataSourceName, tableName string) {
+	initPolicy(t, db, tableName)
+
+	a, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer a.Close(context.Background())
+
+	if _, err = pqnotify.NewWatcher(a, dataSourceName); !errors.Is(err, ErrNotifyDisabled) {
+		t.Error("pqnotify.NewWatcher without notify test failed, err: ", err)
+	}
+
+	var opErr *OpError
+	if _, err = a.DecodeNotification("not json"); !errors.As(err, &opErr) || opErr.Op != "DecodeNotification" {
+		t.Error("DecodeNotification with malformed payload test failed, err: ", err)
+	}
+
+	if db.DriverName() != "postgres" {
+		if _, err = NewAdapter(db, tableName, WithNotify("")); !errors.Is(err, ErrUnsupportedDriver) {
+			t.Error("WithNotify on the other databases test failed, err: ", err)
+		}
+		return
+	}
+
+	// the instance A notifies the changes without a watcher.
+	a1, err := NewAdapter(db, tableName, WithNotify(""))
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer a1.Close(context.Background())
+
+	// the instance B applies the changes of the instance A.
+	a2, err := NewAdapter(db, tableName, WithNotify(""))
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer a2.Close(context.Background())
+
+	w2, err := pqnotify.NewWatcher(a2, dataSourceName)
+	if err != nil {
+		t.Fatal("pqnotify.NewWatcher test failed, err: ", err)
+	}
+
+	e2, _ := casbin.NewEnforcer(testRbacModelFile, a2)
+	if err = e2.SetWatcher(w2); err != nil {
+		t.Fatal("SetWatcher test failed, err: ", err)
+	}
+
+	changes := make(chan Change, 16)
+	w2.SetChangeCallback(func(c Change) {
+		if err := ApplyChange(e2, c); err != nil {
+			t.Error("ApplyChange test failed, err: ", err)
+		}
+		changes <- c
+	})
+
+	if err = a1.AddPolicyCtx(WithActor(context.Background(), "admin"), "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatal("AddPolicyCtx test failed, err: ", err)
+	}
+
+	select {
+	case c := <-changes:
+		if c.Op != OpAddPolicy || c.Actor != "admin" || !util.ArrayEquals(c.Rule, []string{"carol", "data3", "read"}) {
+			t.Errorf("pqnotify.Watcher test failed, change: %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pqnotify.Watcher test failed, the change callback is not called")
+	}
+
+	if ok, _ := e2.Enforce("carol", "data3", "read"); !ok {
+		t.Error("pqnotify.Watcher test failed, the added policy is not applied")
+	}
+
+	// the changes of the instance itself are skipped.
+	if err = a2.AddPolicy("p", "p", []string{"erin", "data4", "read"}); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+
+	select {
+	case c := <-changes:
+		t.Errorf("pqnotify.Watcher test failed, the own change is applied: %+v", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the malformed notification is passed to the error callback.
+	errs := make(chan error, 16)
+	w2.SetErrorCallback(func(err error) {
+		errs <- err
+	})
+
+	channel, err := a2.NotifyChannel()
+	if err != nil {
+		t.Fatal("NotifyChannel test failed, err: ", err)
+	}
+
+	if _, err = db.Exec("SELECT pg_notify($1, $2)", channel, "not json"); err != nil {
+		t.Fatal("pg_notify failed, err: ", err)
+	}
+
+	select {
+	case err = <-errs:
+		if !errors.As(err, &opErr) || opErr.Op != "DecodeNotification" {
+			t.Error("pqnotify.Watcher error callback test failed, err: ", err)
+		}
+	case c := <-changes:
+		t.Errorf("pqnotify.Watcher error callback test failed, the malformed notification is applied: %+v", c)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pqnotify.Watcher error callback test failed, the callback is not called")
+	}
+}
+
+func testAudit(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	a0, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	if _, err = a0.ListAudit(context.Background(), AuditQuery{}); !errors.Is(err, ErrAuditDisabled) {
+		t.Error("ListAudit without audit test failed, err: ", err)
+	}
+
+	a, err := NewAdapter(db, tableName, WithAudit())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	start := time.Now()
+
+	ctx := WithRequestID(WithActor(context.Background(), "admin"), "req-1")
+	if err = a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatal("AddPolicyCtx test failed, err: ", err)
+	}
+	if err = a.UpdatePolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}, []string{"carol", "data3", "write"}); err != nil {
+		t.Fatal("UpdatePolicyCtx test failed, err: ", err)
+	}
+	if err = a.RemovePolicyCtx(WithActor(context.Background(), "bob"), "p", "p", []string{"carol", "data3", "write"}); err != nil {
+		t.Fatal("RemovePolicyCtx test failed, err: ", err)
+	}
+
+	// the failed write is not recorded.
+	if err = a.AddPolicyCtx(ctx, "p", "p", []string{"a", "b", "c", "d", "e", "f", "g"}); !errors.Is(err, ErrRuleTooLong) {
+		t.Error("AddPolicyCtx with too long rule test failed, err: ", err)
+	}
+
+	// the writes rejected by the strict mode are not recorded.
+	strict, err := NewAdapter(db, tableName, WithAudit(), WithStrict(true))
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	if err = strict.RemovePolicyCtx(ctx, "p", "p", []string{"carol", "data3", "write"}); !errors.Is(err, ErrNotFound) {
+		t.Error("RemovePolicyCtx with missing rule in strict mode test failed, err: ", err)
+	}
+
+	if err = strict.UpdatePolicyCtx(ctx, "p", "p", []string{"carol", "data3", "write"}, []string{"carol", "data3", "read"}); !errors.Is(err, ErrNotFound) {
+		t.Error("UpdatePolicyCtx with missing rule in strict mode test failed, err: ", err)
+	}
+
+	if _, err = strict.RemoveFilteredPolicyAffected(ctx, "p", "p", 0, "carol"); !errors.Is(err, ErrNotFound) {
+		t.Error("RemoveFilteredPolicyAffected with missing rule in strict mode test failed, err: ", err)
+	}
+
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal("SavePolicy test failed, err: ", err)
+	}
+
+	entries, err := a.ListAudit(context.Background(), AuditQuery{})
+	if err != nil {
+		t.Fatal("ListAudit test failed, err: ", err)
+	}
+	if len(entries) != 4 || entries[3].Op != OpSavePolicy {
+		t.Fatalf("ListAudit test failed, got %d entries", len(entries))
+	}
+
+	entries, err = a.ListAudit(context.Background(), AuditQuery{Actor: "admin"})
+	if err != nil {
+		t.Fatal("ListAudit by actor test failed, err: ", err)
+	}
+	if len(entries) != 2 || entries[0].Op != OpAddPolicy || entries[0].RequestID != "req-1" ||
+		entries[1].Op != OpUpdatePolicy || !util.ArrayEquals(entries[1].OldRule, []string{"carol", "data3", "read"}) ||
+		!util.ArrayEquals(entries[1].Rule, []string{"carol", "data3", "write"}) {
+		t.Errorf("ListAudit by actor test failed, entries: %+v", entries)
+	}
+
+	// the rule matches the new rule or the old rule.
+	entries, err = a.ListAudit(context.Background(), AuditQuery{PType: "p", Rule: []string{"carol", "", "read"}})
+	if err != nil {
+		t.Fatal("ListAudit by rule test failed, err: ", err)
+	}
+	if len(entries) != 2 || entries[0].Op != OpAddPolicy || entries[1].Op != OpUpdatePolicy {
+		t.Errorf("ListAudit by rule test failed, entries: %+v", entries)
+	}
+
+	entries, err = a.ListAudit(context.Background(), AuditQuery{Rule: []string{"carol"}, Limit: 2})
+	if err != nil {
+		t.Fatal("ListAudit with limit test failed, err: ", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("ListAudit with limit test failed, got %d entries", len(entries))
+	}
+
+	entries, err = a.ListAudit(context.Background(), AuditQuery{Since: start.Add(-time.Hour), Until: start})
+	if err != nil {
+		t.Fatal("ListAudit by time range test failed, err: ", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("ListAudit by time range test failed, got %d entries", len(entries))
+	}
+
+	// SavePolicy records the removed and the added rules, RemoveFilteredPolicy records the removed rules.
+	since := time.Now()
+
+	e.EnableAutoSave(false)
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	_, _ = e.AddPolicy("dave", "data4", "read")
+
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal("SavePolicy test failed, err: ", err)
+	}
+	if err = a.RemoveFilteredPolicy("p", "p", 0, "data2_admin"); err != nil {
+		t.Fatal("RemoveFilteredPolicy test failed, err: ", err)
+	}
+
+	entries, err = a.ListAudit(context.Background(), AuditQuery{Since: since})
+	if err != nil {
+		t.Fatal("ListAudit of SavePolicy test failed, err: ", err)
+	}
+
+	want := []struct {
+		op   string
+		rule []string
+	}{
+		{OpSavePolicy, nil},
+		{OpRemovePolicy, []string{"alice", "data1", "read"}},
+		{OpAddPolicy, []string{"dave", "data4", "read"}},
+		{OpRemoveFilteredPolicy, []string{"data2_admin"}},
+	}
+	if len(entries) != len(want)+2 {
+		t.Fatalf("ListAudit of SavePolicy test failed, entries: %+v", entries)
+	}
+	for idx, entry := range entries {
+		// the removed rules of the filter are in any order.
+		if idx >= len(want) {
+			if entry.Op != OpRemovePolicy || entry.Rule[0] != "data2_admin" || entry.PType != "p" {
+				t.Errorf("ListAudit of RemoveFilteredPolicy test failed, entry: %+v", entry)
+			}
+			continue
+		}
+		if entry.Op != want[idx].op || !util.ArrayEquals(entry.Rule, want[idx].rule) {
+			t.Errorf("ListAudit of SavePolicy test failed, entry %d: %+v", idx, entry)
+		}
+	}
+}
+
+func testSaveLoad(t *testing.T, db *sqlx.DB, tableName string) {
+	// Initialize some policy in DB.
+	initPolicy(t, db, tableName)
+	// Note: you don't need to look at the above code
+	// if you already have a working DB with policy inside.
+
+	// Now the DB has policy, so we can provide a normal use case.
+	// Create an adapter and an enforcer.
+	// NewEnforcer() will load the policy automatically.
+	a, _ := NewAdapter(db, tableName)
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+}
+
+func testAutoSave(t *testing.T, db *sqlx.DB, tableName string) {
+	// Initialize some policy in DB.
+	initPolicy(t, db, tableName)
+	// Note: you don't need to look at the above code
+	// if you already have a working DB with policy inside.
+
+	// Now the DB has policy, so we can provide a normal use case.
+	// Create an adapter and an enforcer.
+	// NewEnforcer() will load the policy automatically.
+	a, _ := NewAdapter(db, tableName)
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+
+	// AutoSave is enabled by default.
+	// Now we disable it.
+	e.EnableAutoSave(false)
+
+	var err error
+	logErr := func(action string) {
+		if err != nil {
+			t.Errorf("%s test failed, err: %v", action, err)
+		}
+	}
+
+	// Because AutoSave is disabled, the policy change only affects the policy in Casbin enforcer,
+	// it doesn't affect the policy in the storage.
+	_, err = e.AddPolicy("alice", "data1", "write")
+	logErr("AddPolicy1")
+	// Reload the policy from the storage to see the effect.
+	err = e.LoadPolicy()
+	logErr("LoadPolicy1")
+	// This is still the original policy.
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	_, err = e.AddPolicies([][]string{{"alice_1", "data_1", "read_1"}, {"bob_1", "data_1", "write_1"}})
+	logErr("AddPolicies1")
+	// Reload the policy from the storage to see the effect.
+	err = e.LoadPolicy()
+	logErr("LoadPolicy2")
+	// This is still the original policy.
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	// Now we enable the AutoSave.
+	e.EnableAutoSave(true)
+
+	// Because AutoSave is enabled, the policy change not only affects the policy in Casbin enforcer,
+	// but also affects the policy in the storage.
+	_, err = e.AddPolicy("alice", "data1", "write")
+	logErr("AddPolicy2")
+	// Reload the policy from the storage to see the effect.
+	err = e.LoadPolicy()
+	logErr("LoadPolicy3")
+	// The policy has a new rule: {"alice", "data1", "write"}.
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"alice", "data1", "write"}})
+
+	_, err = e.AddPolicies([][]string{{"alice_2", "data_2", "read_2"}, {"bob_2", "data_2", "write_2"}})
+	logErr("AddPolicies2")
+	// Reload the policy from the storage to see the effect.
+	err = e.LoadPolicy()
+	logErr("LoadPolicy4")
+	// This is still the original policy.
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"alice", "data1", "write"},
+		{"alice_2", "data_2", "read_2"}, {"bob_2", "data_2", "write_2"}})
+
+	_, err = e.RemovePolicies([][]string{{"alice_2", "data_2", "read_2"}, {"bob_2", "data_2", "write_2"}})
+	logErr("RemovePolicies")
+	err = e.LoadPolicy()
+	logErr("LoadPolicy5")
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"alice", "data1", "write"}})
+
+	// Remove the added rule.
+	_, err = e.RemovePolicy("alice", "data1", "write")
+	logErr("RemovePolicy")
+	err = e.LoadPolicy()
+	logErr("LoadPolicy6")
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	// Remove "data2_admin" related policy rules via a filter.
+	// Two rules: {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"} are deleted.
+	_, err = e.RemoveFilteredPolicy(0, "data2_admin")
+	logErr("RemoveFilteredPolicy")
+	err = e.LoadPolicy()
+	logErr("LoadPolicy7")
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+}
+
+func testFilteredPolicy(t *testing.T, db *sqlx.DB, tableName string) {
+	// Initialize some policy in DB.
+	initPolicy(t, db, tableName)
+	// Note: you don't need to look at the above code
+	// if you already have a working DB with policy inside.
+
+	// Now the DB has policy, so we can provide a normal use case.
+	// Create an adapter and an enforcer.
+	// NewEnforcer() will load the policy automatically.
+	a, _ := NewAdapter(db, tableName)
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	// Now set the adapter
+	e.SetAdapter(a)
+
+	var err error
+	logErr := func(action string) {
+		if err != nil {
+			t.Errorf("%s test failed, err: %v", action, err)
+		}
+	}
+
+	// Load only alice's policies
+	err = e.LoadFilteredPolicy(&Filter{V0: []string{"alice"}})
+	logErr("LoadFilteredPolicy alice")
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+
+	// Load only bob's policies
+	err = e.LoadFilteredPolicy(&Filter{V0: []string{"bob"}})
+	logErr("LoadFilteredPolicy bob")
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}})
+
+	// Load policies for data2_admin
+	err = e.LoadFilteredPolicy(&Filter{V0: []string{"data2_admin"}})
+	logErr("LoadFilteredPolicy data2_admin")
+	testGetPolicy(t, e, [][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	// Load policies for alice and bob
+	err = e.LoadFilteredPolicy(&Filter{V0: []string{"alice", "bob"}})
+	logErr("LoadFilteredPolicy alice bob")
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+
+	_, err = e.AddPolicy("bob", "data2", "read")
+	logErr("AddPolicy")
+
+	err = e.LoadFilteredPolicy(&filter)
+	logErr("LoadFilteredPolicy filter")
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "read"}})
+}
+
+func testUpdatePolicy(t *testing.T, db *sqlx.DB, tableName string) {
+	// Initialize some policy in DB.
+	initPolicy(t, db, tableName)
+
+	a, _ := NewAdapter(db, tableName)
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+
+	e.EnableAutoSave(true)
+	e.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1", "write"})
+	e.LoadPolicy()
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "write"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+}
+
+func testUpdatePolicies(t *testing.T, db *sqlx.DB, tableName string) {
+	// Initialize some policy in DB.
+	initPolicy(t, db, tableName)
+
+	a, _ := NewAdapter(db, tableName)
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+
+	e.EnableAutoSave(true)
+	e.UpdatePolicies([][]string{{"alice", "data1", "write"}, {"bob", "data2", "write"}}, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "read"}})
+	e.LoadPolicy()
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+}
+
+func testUpdateFilteredPolicies(t *testing.T, db *sqlx.DB, tableName string) {
+	// Initialize some policy in DB.
+	initPolicy(t, db, tableName)
+
+	a, _ := NewAdapter(db, tableName)
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+
+	e.EnableAutoSave(true)
+	e.UpdateFilteredPolicies([][]string{{"alice", "data1", "write"}}, 0, "alice", "data1", "read")
+	e.UpdateFilteredPolicies([][]string{{"bob", "data2", "read"}}, 0, "bob", "data2", "write")
+	e.LoadPolicy()
+	testGetPolicyWithoutOrder(t, e, [][]string{{"alice", "data1", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"bob", "data2", "read"}})
+
+	oldPolicies, err := a.UpdateFilteredPolicies("p", "p", [][]string{{"data2_admin", "data3", "read"}}, 0, "data2_admin")
+	if err != nil {
+		t.Fatal("UpdateFilteredPolicies test failed, err: ", err)
+	}
+
+	if !arrayEqualsWithoutOrder(oldPolicies, [][]string{{"p", "data2_admin", "data2", "read"}, {"p", "data2_admin", "data2", "write"}}) {
+		t.Error("UpdateFilteredPolicies old policies test failed, old policies: ", oldPolicies)
+	}
+
+	// the empty middle field is kept, the same as RemoveFilteredPolicyReturning.
+	if err = a.AddPolicy("p", "p", []string{"carol", "", "read"}); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+
+	oldPolicies, err = a.UpdateFilteredPolicies("p", "p", [][]string{{"carol", "data3", "read"}}, 0, "carol")
+	if err != nil {
+		t.Fatal("UpdateFilteredPolicies test failed, err: ", err)
+	}
+
+	if !arrayEqualsWithoutOrder(oldPolicies, [][]string{{"p", "carol", "", "read"}}) {
+		t.Error("UpdateFilteredPolicies old policies with empty field test failed, old policies: ", oldPolicies)
+	}
+
+	rules, err := a.RemoveFilteredPolicyReturning(context.Background(), "p", "p", 0, "carol")
+	if err != nil {
+		t.Fatal("RemoveFilteredPolicyReturning test failed, err: ", err)
+	}
+
+	if !arrayEqualsWithoutOrder(rules, [][]string{{"p", "carol", "data3", "read"}}) {
+		t.Error("RemoveFilteredPolicyReturning test failed, rules: ", rules)
+	}
+}
+
+func testHistory(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	a0, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a0)
+	if err = a0.LoadPolicyAsOf(context.Background(), e.GetModel(), time.Now()); !errors.Is(err, ErrHistoryDisabled) {
+		t.Error("LoadPolicyAsOf without history test failed, err: ", err)
+	}
+
+	// the columns are added to the existing table.
+	a, err := NewAdapter(db, tableName, WithHistory())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	e, _ = casbin.NewEnforcer(testRbacModelFile, a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	// the times between the writes.
+	var times [4]time.Time
+
+	times[0] = time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err = e.AddPolicy("carol", "data3", "read"); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+
+	times[1] = time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err = e.RemovePolicy("alice", "data1", "read"); err != nil {
+		t.Fatal("RemovePolicy test failed, err: ", err)
+	}
+
+	times[2] = time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err = e.UpdatePolicy([]string{"bob", "data2", "write"}, []string{"bob", "data2", "read"}); err != nil {
+		t.Fatal("UpdatePolicy test failed, err: ", err)
+	}
+
+	times[3] = time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err = e.RemoveFilteredPolicy(0, "data2_admin"); err != nil {
+		t.Fatal("RemoveFilteredPolicy test failed, err: ", err)
+	}
+
+	// the batch statements.
+	if _, err = e.AddPolicies([][]string{{"eve", "data5", "read"}, {"eve", "data5", "write"}}); err != nil {
+		t.Fatal("AddPolicies test failed, err: ", err)
+	}
+	if _, err = e.RemovePolicies([][]string{{"eve", "data5", "read"}, {"eve", "data5", "write"}}); err != nil {
+		t.Fatal("RemovePolicies test failed, err: ", err)
+	}
+
+	// the closed rows are not removed again.
+	if affected, err := a.RemovePoliciesAffected(context.Background(), "p", "p", [][]string{{"alice", "data1", "read"}}); err != nil || affected != 0 {
+		t.Errorf("RemovePoliciesAffected of the closed rule test failed, affected: %d, err: %v", affected, err)
+	}
+
+	current := [][]string{{"bob", "data2", "read"}, {"carol", "data3", "read"}}
+
+	e.ClearPolicy()
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+	testGetPolicyWithoutOrder(t, e, current)
+
+	for idx, res := range [][][]string{
+		{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}},
+		{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}},
+		{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}},
+		{{"bob", "data2", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}},
+	} {
+		e.ClearPolicy()
+		if err = a.LoadPolicyAsOf(context.Background(), e.GetModel(), times[idx]); err != nil {
+			t.Fatalf("LoadPolicyAsOf times[%d] test failed, err: %v", idx, err)
+		}
+		testGetPolicyWithoutOrder(t, e, res)
+	}
+
+	e.ClearPolicy()
+	if err = a.LoadPolicyAsOf(context.Background(), e.GetModel(), time.Now()); err != nil {
+		t.Fatal("LoadPolicyAsOf now test failed, err: ", err)
+	}
+	testGetPolicyWithoutOrder(t, e, current)
+
+	// SavePolicy closes the current rows and inserts the new ones.
+	e.ClearPolicy()
+	if _, err = e.AddPolicy("dave", "data4", "read"); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+
+	saved := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal("SavePolicy test failed, err: ", err)
+	}
+
+	e.ClearPolicy()
+	if err = a.LoadPolicyAsOf(context.Background(), e.GetModel(), saved); err != nil {
+		t.Fatal("LoadPolicyAsOf before SavePolicy test failed, err: ", err)
+	}
+	testGetPolicyWithoutOrder(t, e, append(current, []string{"dave", "data4", "read"}))
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+	testGetPolicy(t, e, [][]string{{"dave", "data4", "read"}})
+
+	// the new rows are valid from the time the old rows are closed, so no instant loads an empty policy.
+	var closedAt, validFrom int64
+	if err = db.Get(&closedAt, "SELECT MAX(valid_to) FROM "+tableName); err != nil {
+		t.Fatal("select valid_to test failed, err: ", err)
+	}
+	if err = db.Get(&validFrom, "SELECT MAX(valid_from) FROM "+tableName); err != nil {
+		t.Fatal("select valid_from test failed, err: ", err)
+	}
+	if closedAt != validFrom {
+		t.Errorf("SavePolicy in history mode test failed, valid_to: %d, valid_from: %d", closedAt, validFrom)
+	}
+
+	if _, err = a.UpdateFilteredPolicies("p", "p", [][]string{{"dave", "data4", "write"}}, 0, "dave"); err != nil {
+		t.Fatal("UpdateFilteredPolicies test failed, err: ", err)
+	}
+
+	if err = db.Get(&closedAt, "SELECT MAX(valid_to) FROM "+tableName); err != nil {
+		t.Fatal("select valid_to test failed, err: ", err)
+	}
+	if err = db.Get(&validFrom, "SELECT MAX(valid_from) FROM "+tableName); err != nil {
+		t.Fatal("select valid_from test failed, err: ", err)
+	}
+	if closedAt != validFrom {
+		t.Errorf("UpdateFilteredPolicies in history mode test failed, valid_to: %d, valid_from: %d", closedAt, validFrom)
+	}
+
+	e.ClearPolicy()
+	if err = a.LoadPolicyAsOf(context.Background(), e.GetModel(), time.Unix(0, validFrom)); err != nil {
+		t.Fatal("LoadPolicyAsOf at UpdateFilteredPolicies test failed, err: ", err)
+	}
+	testGetPolicy(t, e, [][]string{{"dave", "data4", "write"}})
+
+	// the filtered load sees the current rules only.
+	e.ClearPolicy()
+	if err = a.LoadFilteredPolicy(e.GetModel(), &Filter{V0: []string{"dave"}}); err != nil {
+		t.Fatal("LoadFilteredPolicy test failed, err: ", err)
+	}
+	testGetPolicy(t, e, [][]string{{"dave", "data4", "write"}})
+}
+
+func testSnapshot(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	a, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	ctx := context.Background()
+
+	// the snapshots of the previous runs.
+	snapshots, err := a.ListSnapshots(ctx)
+	if err != nil {
+		t.Fatal("ListSnapshots test failed, err: ", err)
+	}
+	for _, snapshot := range snapshots {
+		if err = a.DeleteSnapshot(ctx, snapshot.Name); err != nil {
+			t.Fatal("DeleteSnapshot test failed, err: ", err)
+		}
+	}
+
+	if err = a.CreateSnapshot(ctx, "before"); err != nil {
+		t.Fatal("CreateSnapshot test failed, err: ", err)
+	}
+	if err = a.CreateSnapshot(ctx, "before"); !errors.Is(err, ErrDuplicate) {
+		t.Error("CreateSnapshot with the existing name test failed, err: ", err)
+	}
+	if err = a.CreateSnapshot(ctx, ""); err == nil {
+		t.Error("CreateSnapshot with the empty name test failed, err is nil")
+	}
+
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	if _, err = e.RemovePolicy("alice", "data1", "read"); err != nil {
+		t.Fatal("RemovePolicy test failed, err: ", err)
+	}
+	if _, err = e.AddPolicies([][]string{{"carol", "data3", "read"}, {"carol", "data3", "write"}}); err != nil {
+		t.Fatal("AddPolicies test failed, err: ", err)
+	}
+
+	if err = a.CreateSnapshot(ctx, "after"); err != nil {
+		t.Fatal("CreateSnapshot test failed, err: ", err)
+	}
+
+	snapshots, err = a.ListSnapshots(ctx)
+	if err != nil {
+		t.Fatal("ListSnapshots test failed, err: ", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Name != "before" || snapshots[0].Rules != 5 ||
+		snapshots[1].Name != "after" || snapshots[1].Rules != 6 || snapshots[0].CreatedAt.After(snapshots[1].CreatedAt) {
+		t.Errorf("ListSnapshots test failed, snapshots: %+v", snapshots)
+	}
+
+	if err = a.RestoreSnapshot(ctx, "before"); err != nil {
+		t.Fatal("RestoreSnapshot test failed, err: ", err)
+	}
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+	testGetPolicyWithoutOrder(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	if ok, _ := e.HasGroupingPolicy("alice", "data2_admin"); !ok {
+		t.Error("RestoreSnapshot test failed, the grouping policy is not restored")
+	}
+
+	if err = a.RestoreSnapshot(ctx, "missing"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Error("RestoreSnapshot of the missing snapshot test failed, err: ", err)
+	}
+
+	if err = a.DeleteSnapshot(ctx, "after"); err != nil {
+		t.Fatal("DeleteSnapshot test failed, err: ", err)
+	}
+	if err = a.DeleteSnapshot(ctx, "after"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Error("DeleteSnapshot of the missing snapshot test failed, err: ", err)
+	}
+
+	snapshots, err = a.ListSnapshots(ctx)
+	if err != nil {
+		t.Fatal("ListSnapshots test failed, err: ", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Name != "before" {
+		t.Errorf("ListSnapshots after DeleteSnapshot test failed, snapshots: %+v", snapshots)
+	}
+}
+
+func testSoftDelete(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	ctx := context.Background()
+
+	if _, err := NewAdapter(db, tableName, WithHistory(), WithSoftDelete()); err == nil {
+		t.Error("NewAdapter with history and soft delete test failed, err is nil")
+	}
+
+	a0, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	if err = a0.RestorePolicy(ctx, "p", "p", []string{"alice", "data1", "read"}); !errors.Is(err, ErrSoftDeleteDisabled) {
+		t.Error("RestorePolicy without soft delete test failed, err: ", err)
+	}
+	if _, err = a0.PurgeDeleted(ctx, 0); !errors.Is(err, ErrSoftDeleteDisabled) {
+		t.Error("PurgeDeleted without soft delete test failed, err: ", err)
+	}
+
+	// the column is added to the existing table.
+	a, err := NewAdapter(db, tableName, WithSoftDelete())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+
+	if _, err = e.RemovePolicy("alice", "data1", "read"); err != nil {
+		t.Fatal("RemovePolicy test failed, err: ", err)
+	}
+	if _, err = e.RemoveFilteredPolicy(0, "data2_admin"); err != nil {
+		t.Fatal("RemoveFilteredPolicy test failed, err: ", err)
+	}
+
+	// the removed rows are not removed again.
+	if affected, err := a.RemovePoliciesAffected(ctx, "p", "p", [][]string{{"alice", "data1", "read"}}); err != nil || affected != 0 {
+		t.Errorf("RemovePoliciesAffected of the removed rule test failed, affected: %d, err: %v", affected, err)
+	}
+
+	// the rows are updated in place.
+	if _, err = e.UpdatePolicy([]string{"bob", "data2", "write"}, []string{"bob", "data2", "read"}); err != nil {
+		t.Fatal("UpdatePolicy test failed, err: ", err)
+	}
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "read"}})
+
+	if err = a.RestorePolicy(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatal("RestorePolicy test failed, err: ", err)
+	}
+	if err = a.RestorePolicy(ctx, "p", "p", []string{"alice", "data1", "read"}); !errors.Is(err, ErrDuplicate) {
+		t.Error("RestorePolicy of the existing rule test failed, err: ", err)
+	}
+	if err = a.RestorePolicy(ctx, "p", "p", []string{"carol", "data3", "read"}); !errors.Is(err, ErrNotFound) {
+		t.Error("RestorePolicy of the unknown rule test failed, err: ", err)
+	}
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+	testGetPolicyWithoutOrder(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "read"}})
+
+	// the removed rows are purged after the time.
+	if affected, err := a.PurgeDeleted(ctx, time.Hour); err != nil || affected != 0 {
+		t.Errorf("PurgeDeleted an hour ago test failed, affected: %d, err: %v", affected, err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if affected, err := a.PurgeDeleted(ctx, 0); err != nil || affected != 2 {
+		t.Errorf("PurgeDeleted test failed, affected: %d, err: %v", affected, err)
+	}
+	if err = a.RestorePolicy(ctx, "p", "p", []string{"data2_admin", "data2", "read"}); !errors.Is(err, ErrNotFound) {
+		t.Error("RestorePolicy of the purged rule test failed, err: ", err)
+	}
+
+	// SavePolicy removes the current rows softly.
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal("SavePolicy test failed, err: ", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if affected, err := a.PurgeDeleted(ctx, 0); err != nil || affected != 3 {
+		t.Errorf("PurgeDeleted after SavePolicy test failed, affected: %d, err: %v", affected, err)
+	}
+
+	// the filtered load sees the current rows only.
+	e.ClearPolicy()
+	if err = a.LoadFilteredPolicy(e.GetModel(), &Filter{V0: []string{"alice", "data2_admin"}}); err != nil {
+		t.Fatal("LoadFilteredPolicy test failed, err: ", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+}
+
+func testExpiry(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	ctx := context.Background()
+
+	if _, err := NewAdapter(db, tableName, WithHistory(), WithExpiry()); err == nil {
+		t.Error("NewAdapter with history and expiry test failed, err is nil")
+	}
+
+	a0, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	if err = a0.AddPolicyWithExpiry(ctx, "p", "p", []string{"carol", "data3", "read"}, time.Time{}, time.Now().Add(time.Hour)); !errors.Is(err, ErrExpiryDisabled) {
+		t.Error("AddPolicyWithExpiry without expiry test failed, err: ", err)
+	}
+	if _, err = a0.PurgeExpired(ctx); !errors.Is(err, ErrExpiryDisabled) {
+		t.Error("PurgeExpired without expiry test failed, err: ", err)
+	}
+
+	// the columns are added to the existing table.
+	a, err := NewAdapter(db, tableName, WithExpiry())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	now := time.Now()
+
+	if err = a.AddPolicyWithExpiry(ctx, "p", "p", []string{"carol", "data3", "read"}, time.Time{}, now.Add(time.Hour)); err != nil {
+		t.Fatal("AddPolicyWithExpiry test failed, err: ", err)
+	}
+	if err = a.AddPolicyWithExpiry(ctx, "p", "p", []string{"dave", "data4", "read"}, now.Add(time.Hour), time.Time{}); err != nil {
+		t.Fatal("AddPolicyWithExpiry in the future test failed, err: ", err)
+	}
+	if err = a.AddPolicyWithExpiry(ctx, "p", "p", []string{"eve", "data5", "read"}, now.Add(-2*time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Fatal("AddPolicyWithExpiry in the past test failed, err: ", err)
+	}
+	if err = a.AddPolicyWithExpiry(ctx, "p", "p", []string{"eve", "data5", "write"}, now, now); err == nil {
+		t.Error("AddPolicyWithExpiry with the empty window test failed, err is nil")
+	}
+
+	valid := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}}
+
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	testGetPolicyWithoutOrder(t, e, valid)
+
+	// SavePolicy keeps the time-bounded rows and does not insert them again.
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal("SavePolicy test failed, err: ", err)
+	}
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+	testGetPolicyWithoutOrder(t, e, valid)
+
+	rules, err := a.PurgeExpired(ctx)
+	if err != nil {
+		t.Fatal("PurgeExpired test failed, err: ", err)
+	}
+	if len(rules) != 1 || !util.ArrayEquals(rules[0], []string{"p", "eve", "data5", "read"}) {
+		t.Errorf("PurgeExpired test failed, rules: %v", rules)
+	}
+
+	if rules, err = a.PurgeExpired(ctx); err != nil || len(rules) != 0 {
+		t.Errorf("PurgeExpired again test failed, rules: %v, err: %v", rules, err)
+	}
+
+	// the filtered load excludes the rules out of their window.
+	e.ClearPolicy()
+	if err = a.LoadFilteredPolicy(e.GetModel(), &Filter{V0: []string{"carol", "dave", "eve"}}); err != nil {
+		t.Fatal("LoadFilteredPolicy test failed, err: ", err)
+	}
+	testGetPolicy(t, e, [][]string{{"carol", "data3", "read"}})
+
+	// the grant in the future is audited, though it is not applied incrementally.
+	aa, err := NewAdapter(db, tableName, WithExpiry(), WithAudit())
+	if err != nil {
+		t.Fatal("NewAdapter with audit test failed, err: ", err)
+	}
+
+	since := time.Now()
+
+	if err = aa.AddPolicyWithExpiry(WithActor(ctx, "admin"), "p", "p", []string{"frank", "data6", "read"}, now.Add(time.Hour), time.Time{}); err != nil {
+		t.Fatal("AddPolicyWithExpiry in the future test failed, err: ", err)
+	}
+
+	entries, err := aa.ListAudit(ctx, AuditQuery{Since: since})
+	if err != nil {
+		t.Fatal("ListAudit test failed, err: ", err)
+	}
+	if len(entries) != 1 || entries[0].Op != OpAddPolicy || entries[0].Actor != "admin" ||
+		!util.ArrayEquals(entries[0].Rule, []string{"frank", "data6", "read"}) {
+		t.Errorf("ListAudit of the grant in the future test failed, entries: %+v", entries)
+	}
+
+	// the snapshot only copies the 5 unbounded rules, so the time-bounded rules are not restored as the unbounded rules.
+	if err = aa.CreateSnapshot(ctx, "expiry"); err != nil {
+		t.Fatal("CreateSnapshot test failed, err: ", err)
+	}
+	if snapshots, err := aa.ListSnapshots(ctx); err != nil || len(snapshots) != 1 || snapshots[0].Rules != 5 {
+		t.Errorf("ListSnapshots test failed, snapshots: %+v, err: %v", snapshots, err)
+	}
+	if _, err = db.Exec("DELETE FROM " + tableName + " WHERE v0='carol'"); err != nil {
+		t.Fatal("delete the time-bounded rule failed, err: ", err)
+	}
+	if err = aa.RestoreSnapshot(ctx, "expiry"); err != nil {
+		t.Fatal("RestoreSnapshot test failed, err: ", err)
+	}
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+	testGetPolicyWithoutOrder(t, e, valid[:4])
+
+	// the expired rule which is still granted by an identical unbounded row is not removed from the peers.
+	ac, err := NewAdapter(db, tableName, WithExpiry(), WithChangelog(), WithAudit())
+	if err != nil {
+		t.Fatal("NewAdapter with change log test failed, err: ", err)
+	}
+
+	if err = ac.AddPolicyWithExpiry(ctx, "p", "p", []string{"grace", "data7", "read"}, now.Add(-2*time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Fatal("AddPolicyWithExpiry in the past test failed, err: ", err)
+	}
+	if err = ac.AddPolicy("p", "p", []string{"grace", "data7", "read"}); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+	if err = ac.AddPolicyWithExpiry(ctx, "p", "p", []string{"heidi", "data8", "read"}, now.Add(-2*time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Fatal("AddPolicyWithExpiry in the past test failed, err: ", err)
+	}
+
+	since = time.Now()
+
+	if rules, err = ac.PurgeExpired(ctx); err != nil || len(rules) != 2 {
+		t.Errorf("PurgeExpired with the unbounded rule test failed, rules: %v, err: %v", rules, err)
+	}
+
+	var removed []string
+	if err = db.Select(&removed, db.Rebind("SELECT v0 FROM "+tableName+"_changelog WHERE op=?"), OpRemovePolicy); err != nil {
+		t.Fatal("select the change log failed, err: ", err)
+	}
+	if !util.ArrayEquals(removed, []string{"heidi"}) {
+		t.Errorf("PurgeExpired change log test failed, removed: %v", removed)
+	}
+
+	if entries, err = ac.ListAudit(ctx, AuditQuery{Since: since}); err != nil || len(entries) != 2 {
+		t.Errorf("ListAudit of PurgeExpired test failed, entries: %+v, err: %v", entries, err)
+	}
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+	testGetPolicyWithoutOrder(t, e, append(valid[:4:4], []string{"grace", "data7", "read"}))
+}
+
+func testTenant(t *testing.T, db *sqlx.DB, tableName string) {
+	initPolicy(t, db, tableName)
+
+	ctx := context.Background()
+
+	a0, err := NewAdapter(db, tableName)
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	if _, err = a0.ForTenant("acme"); !errors.Is(err, ErrTenantDisabled) {
+		t.Error("ForTenant without tenant column test failed, err: ", err)
+	}
+
+	// the column is added to the existing table, the existing rows have no tenant.
+	a, err := NewAdapter(db, tableName, WithTenantColumn())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	for _, id := range []string{"", "acme' OR '1'='1", "acme corp"} {
+		if _, err = a.ForTenant(id); err == nil {
+			t.Errorf("ForTenant with the invalid id %q test failed, err is nil", id)
+		}
+	}
+
+	acme, err := a.ForTenant("acme")
+	if err != nil {
+		t.Fatal("ForTenant test failed, err: ", err)
+	}
+
+	globex, err := a.ForTenant("globex")
+	if err != nil {
+		t.Fatal("ForTenant test failed, err: ", err)
+	}
+
+	e, _ := casbin.NewEnforcer(testRbacModelFile, a)
+	ea, _ := casbin.NewEnforcer(testRbacModelFile, acme)
+	eg, _ := casbin.NewEnforcer(testRbacModelFile, globex)
+
+	initial := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}
+
+	testGetPolicy(t, e, initial)
+	testGetPolicy(t, ea, [][]string{})
+
+	for _, te := range []*casbin.Enforcer{ea, eg} {
+		if _, err = te.AddPolicies([][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}); err != nil {
+			t.Fatal("AddPolicies test failed, err: ", err)
+		}
+	}
+
+	// the writes of a tenant do not touch the rows of the others.
+	if _, err = ea.RemovePolicy("alice", "data1", "read"); err != nil {
+		t.Fatal("RemovePolicy test failed, err: ", err)
+	}
+	if _, err = ea.UpdatePolicy([]string{"bob", "data2", "write"}, []string{"bob", "data2", "read"}); err != nil {
+		t.Fatal("UpdatePolicy test failed, err: ", err)
+	}
+	if _, err = eg.RemoveFilteredPolicy(0, "bob"); err != nil {
+		t.Fatal("RemoveFilteredPolicy test failed, err: ", err)
+	}
+
+	for _, te := range []*casbin.Enforcer{e, ea, eg} {
+		if err = te.LoadPolicy(); err != nil {
+			t.Fatal("LoadPolicy test failed, err: ", err)
+		}
+	}
+
+	testGetPolicy(t, e, initial)
+	testGetPolicy(t, ea, [][]string{{"bob", "data2", "read"}})
+	testGetPolicy(t, eg, [][]string{{"alice", "data1", "read"}})
+
+	if err = acme.CreateSnapshot(ctx, "acme-1"); err != nil {
+		t.Fatal("CreateSnapshot test failed, err: ", err)
+	}
+
+	// SavePolicy of a tenant does not wipe the rules of the others.
+	ea.ClearPolicy()
+	if err = ea.SavePolicy(); err != nil {
+		t.Fatal("SavePolicy test failed, err: ", err)
+	}
+
+	for _, te := range []*casbin.Enforcer{e, ea, eg} {
+		if err = te.LoadPolicy(); err != nil {
+			t.Fatal("LoadPolicy test failed, err: ", err)
+		}
+	}
+
+	testGetPolicy(t, e, initial)
+	testGetPolicy(t, ea, [][]string{})
+	testGetPolicy(t, eg, [][]string{{"alice", "data1", "read"}})
+
+	// the snapshots of a tenant are not seen by the others.
+	if snapshots, err := globex.ListSnapshots(ctx); err != nil || len(snapshots) != 0 {
+		t.Errorf("ListSnapshots of the other tenant test failed, snapshots: %+v, err: %v", snapshots, err)
+	}
+	if err = globex.RestoreSnapshot(ctx, "acme-1"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Error("RestoreSnapshot of the other tenant test failed, err: ", err)
+	}
+	if snapshots, err := a.ListSnapshots(ctx); err != nil || len(snapshots) != 0 {
+		t.Errorf("ListSnapshots of the adapter test failed, snapshots: %+v, err: %v", snapshots, err)
+	}
+	for _, name := range []string{"acme/acme-1", "acme/"} {
+		if err = a.RestoreSnapshot(ctx, name); err == nil || errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("RestoreSnapshot with the name %q test failed, err: %v", name, err)
+		}
+		if err = a.CreateSnapshot(ctx, name); err == nil {
+			t.Errorf("CreateSnapshot with the name %q test failed, err is nil", name)
+		}
+	}
+
+	if snapshots, err := acme.ListSnapshots(ctx); err != nil || len(snapshots) != 1 || snapshots[0].Name != "acme-1" {
+		t.Errorf("ListSnapshots test failed, snapshots: %+v, err: %v", snapshots, err)
+	}
+	if err = acme.RestoreSnapshot(ctx, "acme-1"); err != nil {
+		t.Fatal("RestoreSnapshot test failed, err: ", err)
+	}
+
+	if err = ea.LoadPolicy(); err != nil {
+		t.Fatal("LoadPolicy test failed, err: ", err)
+	}
+	testGetPolicy(t, ea, [][]string{{"bob", "data2", "read"}})
+
+	// the filtered load is restricted to the tenant.
+	ef, _ := casbin.NewEnforcer(testRbacModelFile)
+	if err = globex.LoadFilteredPolicy(ef.GetModel(), &Filter{V0: []string{"alice", "bob"}}); err != nil {
+		t.Fatal("LoadFilteredPolicy test failed, err: ", err)
+	}
+	testGetPolicy(t, ef, [][]string{{"alice", "data1", "read"}})
+
+	// the tenant_id column is indexed when it is added.
+	if _, err = db.Exec("CREATE INDEX idx_" + tableName + "_tenant_id ON " + tableName + " (tenant_id)"); err == nil {
+		t.Error("the index of the tenant_id column test failed, the index does not exist")
+	}
+
+	// the tenant id is bound between the args of the SET clause and the conditions of the modes.
+	ma, err := NewAdapter(db, tableName+"_modes", WithTenantColumn(), WithSoftDelete(), WithExpiry())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+
+	acme, _ = ma.ForTenant("acme")
+	globex, _ = ma.ForTenant("globex")
+
+	rules := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}
+
+	for _, ta := range []*Adapter{acme, globex} {
+		if err = ta.AddPolicies("p", "p", rules); err != nil {
+			t.Fatal("AddPolicies test failed, err: ", err)
+		}
+	}
+
+	if err = acme.RemovePolicy("p", "p", rules[0]); err != nil {
+		t.Fatal("RemovePolicy test failed, err: ", err)
+	}
+	if err = acme.UpdatePolicy("p", "p", rules[1], []string{"bob", "data2", "read"}); err != nil {
+		t.Fatal("UpdatePolicy test failed, err: ", err)
+	}
+	if err = acme.RestorePolicy(ctx, "p", "p", rules[0]); err != nil {
+		t.Fatal("RestorePolicy test failed, err: ", err)
+	}
+	if affected, err := globex.RemovePoliciesAffected(ctx, "p", "p", rules); err != nil || affected != 2 {
+		t.Fatalf("RemovePoliciesAffected test failed, affected: %d, err: %v", affected, err)
+	}
+	if affected, err := acme.PurgeDeleted(ctx, 0); err != nil || affected != 0 {
+		t.Errorf("PurgeDeleted of the restored rule test failed, affected: %d, err: %v", affected, err)
+	}
+	if affected, err := globex.PurgeDeleted(ctx, 0); err != nil || affected != 2 {
+		t.Errorf("PurgeDeleted test failed, affected: %d, err: %v", affected, err)
+	}
+
+	expired := []string{"carol", "data3", "read"}
+	if err = globex.AddPolicyWithExpiry(ctx, "p", "p", expired, time.Time{}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal("AddPolicyWithExpiry test failed, err: ", err)
+	}
+	if purged, err := acme.PurgeExpired(ctx); err != nil || len(purged) != 0 {
+		t.Errorf("PurgeExpired of the other tenant test failed, purged: %v, err: %v", purged, err)
+	}
+	if purged, err := globex.PurgeExpired(ctx); err != nil || len(purged) != 1 {
+		t.Errorf("PurgeExpired test failed, purged: %v, err: %v", purged, err)
+	}
+
+	for _, tc := range []struct {
+		adapter *Adapter
+		res     [][]string
+	}{
+		{ma, [][]string{}},
+		{acme, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "read"}}},
+		{globex, [][]string{}},
+	} {
+		te, _ := casbin.NewEnforcer(testRbacModelFile, tc.adapter)
+		testGetPolicyWithoutOrder(t, te, tc.res)
+	}
+
+	// the change log and the audit record the tenant, the tenant adapters only see the changes of the tenant.
+	la, err := NewAdapter(db, tableName+"_log", WithTenantColumn(), WithChangelog(), WithAudit())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer la.Close(context.Background())
+
+	lb, err := NewAdapter(db, tableName+"_log", WithTenantColumn(), WithChangelog())
+	if err != nil {
+		t.Fatal("NewAdapter test failed, err: ", err)
+	}
+	defer lb.Close(context.Background())
+
+	acmeB, _ := lb.ForTenant("acme")
+
+	watched := make([]chan Change, 0, 2)
+	for _, ta := range []*Adapter{lb, acmeB} {
+		w, err := NewChangelogWatcher(ta, 20*time.Millisecond)
+		if err != nil {
+			t.Fatal("NewChangelogWatcher test failed, err: ", err)
+		}
+
+		changes := make(chan Change, 16)
+		w.SetChangeCallback(func(c Change) { changes <- c })
+		watched = append(watched, changes)
+	}
+
+	acme, _ = la.ForTenant("acme")
+	globex, _ = la.ForTenant("globex")
+
+	if err = globex.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+	if err = acme.AddPolicy("p", "p", rules[0]); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+	if err = la.AddPolicy("p", "p", rules[1]); err != nil {
+		t.Fatal("AddPolicy test failed, err: ", err)
+	}
+
+	for idx, tc := range []struct {
+		adapter *Adapter
+		tenant  string
+		rule    []string
+	}{
+		{la, "", rules[1]},
+		{acme, "acme", rules[0]},
+	} {
+		select {
+		case c := <-watched[idx]:
+			if c.Tenant != tc.tenant || !util.ArrayEquals(c.Rule, tc.rule) {
+				t.Errorf("ChangelogWatcher of the tenant %q test failed, change: %+v", tc.tenant, c)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("ChangelogWatcher of the tenant %q test failed, no change", tc.tenant)
+		}
+
+		select {
+		case c := <-watched[idx]:
+			t.Errorf("ChangelogWatcher of the tenant %q test failed, the change of the other tenant: %+v", tc.tenant, c)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		entries, err := tc.adapter.ListAudit(ctx, AuditQuery{})
+		if err != nil || len(entries) != 1 || entries[0].Tenant != tc.tenant || !util.ArrayEquals(entries[0].Rule, tc.rule) {
+			t.Errorf("ListAudit of the tenant %q test failed, entries: %+v, err: %v", tc.tenant, entries, err)
+		}
+	}
+}
+
+func testTenantIndexes(t *testing.T, db *sqlx.DB, tableName string) {
+	if _, err := NewAdapter(db, tableName, WithIndexes(Index{Columns: []string{"tenant_id", "p_type", "v0", "v1"}})); err == nil {
+		t.Error("NewAdapter with tenant_id index without tenant column test failed, err is nil")
+	}
+
+	// the unique index is created after the tenant_id column is added to the new table.
+	a, err := NewAdapter(db, tableName, WithTenantColumn(), WithIndexes(
+		Index{Columns: []string{"tenant_id", "p_type", "v0", "v1"}, Unique: true},
+	))
+	if err != nil {
+		t.Fatal("NewAdapter with tenant_id unique index test failed, err: ", err)
+	}
+
+	acme, err := a.ForTenant("acme")
+	if err != nil {
+		t.Fatal("ForTenant test failed, err: ", err)
+	}
+
+	globex, err := a.ForTenant("globex")
+	if err != nil {
+		t.Fatal("ForTenant test failed, err: ", err)
+	}
+
+	// the same rule is held by both tenants.
+	for _, ta := range []*Adapter{acme, globex} {
+		if err = ta.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+			t.Error("AddPolicy with tenant_id unique index test failed, err: ", err)
+		}
+	}
+
+	if err = acme.AddPolicy("p", "p", []string{"alice", "data1", "write"}); !errors.Is(err, ErrDuplicate) {
+		t.Error("AddPolicy with tenant_id unique index test failed, err: ", err)
+	}
+
+	for _, ta := range []*Adapter{acme, globex} {
+		e, _ := casbin.NewEnforcer(testRbacModelFile, ta)
+		testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+	}
 }
 
 func testGetPolicy(t *testing.T, e *casbin.Enforcer, res [][]string) {
@@ -0,0 +1,348 @@
+// Copyright 2023 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadaptertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v3/model"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+
+	. "github.com/Blank-Xu/sqlx-adapter"
+)
+
+func TestDialectSQL(t *testing.T) {
+	const (
+		oracleDecode = "DECODE(v0,:%d,1,0)=1 AND DECODE(v1,:%d,1,0)=1 AND DECODE(v2,:%d,1,0)=1 AND " +
+			"DECODE(v3,:%d,1,0)=1 AND DECODE(v4,:%d,1,0)=1 AND DECODE(v5,:%d,1,0)=1"
+		sqlserverRows = "(@p1,@p2,@p3,@p4,@p5,@p6,@p7),(@p8,@p9,@p10,@p11,@p12,@p13,@p14)"
+	)
+
+	for _, tc := range []struct {
+		dialect    Dialect
+		driverName string
+		want       []string
+	}{
+		{
+			dialect:    DialectOracle,
+			driverName: "godror",
+			want: []string{
+				// AddPolicy, and AddPolicies inserts the rows one by one.
+				"INSERT INTO casbin_rule (p_type,v0,v1,v2,v3,v4,v5) VALUES (:1,:2,:3,:4,:5,:6,:7)",
+				"INSERT INTO casbin_rule (p_type,v0,v1,v2,v3,v4,v5) VALUES (:1,:2,:3,:4,:5,:6,:7)",
+				"INSERT INTO casbin_rule (p_type,v0,v1,v2,v3,v4,v5) VALUES (:1,:2,:3,:4,:5,:6,:7)",
+				// RemovePolicies, Oracle stores "" as NULL, the values are compared by DECODE.
+				"DELETE FROM casbin_rule WHERE p_type=:1 AND " + fmt.Sprintf(oracleDecode, 2, 3, 4, 5, 6, 7),
+				"DELETE FROM casbin_rule WHERE p_type=:1 AND " + fmt.Sprintf(oracleDecode, 2, 3, 4, 5, 6, 7),
+				"UPDATE casbin_rule SET p_type=:1,v0=:2,v1=:3,v2=:4,v3=:5,v4=:6,v5=:7 WHERE p_type=:8 AND " +
+					fmt.Sprintf(oracleDecode, 9, 10, 11, 12, 13, 14),
+				// RemoveFilteredPolicyReturning selects the rows before deleting them.
+				"SELECT p_type,v0,v1,v2,v3,v4,v5 FROM casbin_rule WHERE p_type=:1 AND v1=:2 FOR UPDATE",
+				"DELETE FROM casbin_rule WHERE p_type=:1 AND v1=:2",
+			},
+		},
+		{
+			dialect:    DialectSqlserver,
+			driverName: "sqlserver",
+			want: []string{
+				"INSERT INTO casbin_rule (p_type,v0,v1,v2,v3,v4,v5) VALUES (@p1,@p2,@p3,@p4,@p5,@p6,@p7)",
+				"INSERT INTO casbin_rule (p_type,v0,v1,v2,v3,v4,v5) VALUES " + sqlserverRows,
+				"DELETE r FROM casbin_rule AS r INNER JOIN (VALUES " + sqlserverRows + ") AS d (p_type,v0,v1,v2,v3,v4,v5) " +
+					"ON r.p_type=d.p_type AND r.v0=d.v0 AND r.v1=d.v1 AND r.v2=d.v2 AND r.v3=d.v3 AND r.v4=d.v4 AND r.v5=d.v5",
+				"UPDATE casbin_rule SET p_type=@p1,v0=@p2,v1=@p3,v2=@p4,v3=@p5,v4=@p6,v5=@p7 " +
+					"WHERE p_type=@p8 AND v0=@p9 AND v1=@p10 AND v2=@p11 AND v3=@p12 AND v4=@p13 AND v5=@p14",
+				"DELETE FROM casbin_rule OUTPUT DELETED.p_type,DELETED.v0,DELETED.v1,DELETED.v2,DELETED.v3,DELETED.v4,DELETED.v5 " +
+					"WHERE p_type=@p1 AND v1=@p2",
+			},
+		},
+	} {
+		r := &recorder{}
+
+		a, err := NewAdapter(newRecorderDB(r, tc.driverName), "casbin_rule", WithDialect(tc.dialect))
+		if err != nil {
+			t.Fatalf("NewAdapter of %s test failed, err: %v", tc.dialect, err)
+		}
+		r.take("")
+
+		if err = a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+			t.Errorf("AddPolicy of %s test failed, err: %v", tc.dialect, err)
+		}
+
+		if err = a.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}); err != nil {
+			t.Errorf("AddPolicies of %s test failed, err: %v", tc.dialect, err)
+		}
+
+		if err = a.RemovePolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}); err != nil {
+			t.Errorf("RemovePolicies of %s test failed, err: %v", tc.dialect, err)
+		}
+
+		if err = a.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); err != nil {
+			t.Errorf("UpdatePolicy of %s test failed, err: %v", tc.dialect, err)
+		}
+
+		if _, err = a.RemoveFilteredPolicyReturning(context.Background(), "p", "p", 1, "data1"); err != nil {
+			t.Errorf("RemoveFilteredPolicyReturning of %s test failed, err: %v", tc.dialect, err)
+		}
+
+		var got []string
+
+		for _, stmt := range r.take("") {
+			if stmt != "BEGIN" && stmt != "COMMIT" && stmt != "ROLLBACK" {
+				got = append(got, stmt)
+			}
+		}
+
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("the statements of %s test failed, got: %q, want: %q", tc.dialect, got, tc.want)
+		}
+	}
+}
+
+func TestCockroachRetry(t *testing.T) {
+	r := &recorder{}
+
+	a, err := NewAdapter(newRecorderDB(r, "postgres"), "casbin_rule", WithDialect(DialectCockroach))
+	if err != nil {
+		t.Fatal("NewAdapter of cockroach test failed, err: ", err)
+	}
+	r.take("")
+
+	// the first INSERT fails by the serialization error, the transaction is replayed by the default retry policy.
+	var failed bool
+
+	r.fail = func(stmt string) error {
+		if !failed && strings.HasPrefix(stmt, "INSERT") {
+			failed = true
+
+			return &pq.Error{Code: "40001", Message: "restart transaction"}
+		}
+
+		return nil
+	}
+
+	if err = a.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}); err != nil {
+		t.Fatal("AddPolicies of cockroach test failed, err: ", err)
+	}
+
+	got := r.take("")
+	want := []string{
+		"BEGIN",
+		"INSERT INTO casbin_rule (p_type,v0,v1,v2,v3,v4,v5) VALUES ($1,$2,$3,$4,$5,$6,$7),($8,$9,$10,$11,$12,$13,$14)",
+		"ROLLBACK",
+		"BEGIN",
+		"INSERT INTO casbin_rule (p_type,v0,v1,v2,v3,v4,v5) VALUES ($1,$2,$3,$4,$5,$6,$7),($8,$9,$10,$11,$12,$13,$14)",
+		"COMMIT",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AddPolicies of cockroach test failed, got: %q, want: %q", got, want)
+	}
+
+	// the other errors are not retried.
+	r.fail = func(stmt string) error {
+		if strings.HasPrefix(stmt, "INSERT") {
+			return &pq.Error{Code: "23505", Message: "duplicate key value"}
+		}
+
+		return nil
+	}
+
+	if err = a.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}); err == nil {
+		t.Fatal("AddPolicies of cockroach with unique violation test failed, err is nil")
+	}
+
+	if got = r.take("INSERT"); len(got) != 1 {
+		t.Errorf("AddPolicies of cockroach with unique violation test failed, inserted %d times, supposed to be 1", len(got))
+	}
+}
+
+func TestPostgresCopy(t *testing.T) {
+	// the db reports the driver of github.com/lib/pq, the rules are inserted by "COPY FROM STDIN".
+	r := &recorder{driver: &pq.Driver{}}
+
+	a, err := NewAdapter(newRecorderDB(r, "postgres"), "casbin_rule", WithDialect(DialectPostgres), WithCopyThreshold(2))
+	if err != nil {
+		t.Fatal("NewAdapter of postgres test failed, err: ", err)
+	}
+	r.take("")
+
+	const sqlCopyIn = "COPY casbin_rule (p_type,v0,v1,v2,v3,v4,v5) FROM STDIN"
+
+	// the rows below the threshold are inserted by the INSERT statement.
+	if err = a.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}}); err != nil {
+		t.Fatal("AddPolicies of postgres test failed, err: ", err)
+	}
+
+	if got := r.take(sqlCopyIn); len(got) != 0 {
+		t.Errorf("AddPolicies of postgres below the copy threshold test failed, copied: %q", got)
+	}
+
+	// every row is sent by the prepared statement, and the last exec flushes the rows.
+	if err = a.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}); err != nil {
+		t.Fatal("AddPolicies of postgres test failed, err: ", err)
+	}
+
+	got := r.take("")
+	want := []string{"BEGIN", sqlCopyIn, sqlCopyIn, sqlCopyIn, "COMMIT"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AddPolicies of postgres by copy test failed, got: %q, want: %q", got, want)
+	}
+
+	// the transaction is rolled back if any row fails, no row is inserted.
+	var copied int
+
+	r.fail = func(stmt string) error {
+		if stmt == sqlCopyIn {
+			if copied++; copied == 2 {
+				return &pq.Error{Code: "22001", Message: "value too long for type character varying(255)"}
+			}
+		}
+
+		return nil
+	}
+
+	if err = a.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"bob", strings.Repeat("x", 300), "write"}}); err == nil {
+		t.Fatal("AddPolicies of postgres by copy with too long value test failed, err is nil")
+	}
+
+	got = r.take("")
+	want = []string{"BEGIN", sqlCopyIn, sqlCopyIn, "ROLLBACK"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AddPolicies of postgres by copy with too long value test failed, got: %q, want: %q", got, want)
+	}
+}
+
+func TestMysqlErrors(t *testing.T) {
+	r := &recorder{}
+
+	a, err := NewAdapter(newRecorderDB(r, "mysql"), "casbin_rule", WithDialect(DialectMysql))
+	if err != nil {
+		t.Fatal("NewAdapter of mysql test failed, err: ", err)
+	}
+
+	// the driver errors are wrapped, they are classified by the innermost error.
+	r.fail = func(stmt string) error {
+		switch {
+		case strings.HasPrefix(stmt, "INSERT"):
+			return fmt.Errorf("exec: %w", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+		case strings.HasPrefix(stmt, "SELECT"):
+			return fmt.Errorf("query: %w", &mysql.MySQLError{Number: 1146, Message: "Table doesn't exist"})
+		}
+
+		return nil
+	}
+
+	if err = a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); !errors.Is(err, ErrDuplicate) {
+		t.Error("AddPolicy of mysql with wrapped duplicate entry test failed, err: ", err)
+	}
+
+	m, err := model.NewModelFromFile(testRbacModelFile)
+	if err != nil {
+		t.Fatal("NewModelFromFile test failed, err: ", err)
+	}
+
+	if err = a.LoadPolicy(m); !errors.Is(err, ErrTableMissing) {
+		t.Error("LoadPolicy of mysql with wrapped missing table test failed, err: ", err)
+	}
+}
+
+func TestDialectByDriverName(t *testing.T) {
+	// ql is an embedded database, it is not detected as PostgreSQL by the driver name.
+	r := &recorder{}
+
+	a, err := NewAdapter(newRecorderDB(r, "ql"), "casbin_rule")
+	if err != nil {
+		t.Fatal("NewAdapter of ql test failed, err: ", err)
+	}
+	r.take("")
+
+	if err = a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatal("AddPolicy of ql test failed, err: ", err)
+	}
+
+	got := r.take("INSERT")
+	want := []string{"INSERT INTO casbin_rule (p_type,v0,v1,v2,v3,v4,v5) VALUES (?,?,?,?,?,?,?)"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AddPolicy of ql test failed, got: %q, want: %q", got, want)
+	}
+}
+
+func TestHashIndexSQL(t *testing.T) {
+	const columns = "p_type,v0,v1,v2,v3,v4,v5"
+
+	for _, tc := range []struct {
+		dialect    Dialect
+		driverName string
+		want       []string
+	}{
+		{
+			dialect:    DialectMysql,
+			driverName: "mysql",
+			want: []string{
+				"ALTER TABLE casbin_rule ADD COLUMN h_uidx_rule BINARY(32) AS (UNHEX(SHA2(CONCAT_WS(CHAR(0)," + columns + "),256))) STORED",
+				"CREATE UNIQUE INDEX uidx_rule ON casbin_rule (h_uidx_rule)",
+			},
+		},
+		{
+			dialect:    DialectSqlserver,
+			driverName: "sqlserver",
+			want: []string{
+				"CREATE INDEX idx_casbin_rule_v1 ON casbin_rule (v1)",
+				"ALTER TABLE casbin_rule ADD h_uidx_rule AS CAST(HASHBYTES('SHA2_256',CONCAT(" +
+					strings.ReplaceAll(columns, ",", ",NCHAR(0),") + ",NCHAR(0))) AS BINARY(32)) PERSISTED",
+				"CREATE UNIQUE INDEX uidx_rule ON casbin_rule (h_uidx_rule)",
+			},
+		},
+	} {
+		// the table does not exist, it is created with the indexes.
+		r := &recorder{fail: func(stmt string) error {
+			if strings.HasSuffix(stmt, "WHERE 1=0") {
+				return errors.New("table does not exist")
+			}
+
+			return nil
+		}}
+
+		_, err := NewAdapter(newRecorderDB(r, tc.driverName), "casbin_rule", WithDialect(tc.dialect), WithIndexes(
+			Index{Columns: []string{"v1"}},
+			Index{Name: "uidx_rule", Columns: strings.Split(columns, ","), Unique: true, Hash: true},
+		))
+		if err != nil {
+			t.Fatalf("NewAdapter of %s with hash index test failed, err: %v", tc.dialect, err)
+		}
+
+		// the other indexes of MySQL are defined in the CREATE TABLE.
+		var got []string
+
+		for _, stmt := range r.take("") {
+			if strings.HasPrefix(stmt, "CREATE INDEX") || strings.HasPrefix(stmt, "CREATE UNIQUE INDEX") || strings.HasPrefix(stmt, "ALTER TABLE") {
+				got = append(got, stmt)
+			}
+		}
+
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("the hash index of %s test failed, got: %q, want: %q", tc.dialect, got, tc.want)
+		}
+	}
+}
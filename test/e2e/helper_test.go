@@ -26,6 +26,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	_ "github.com/marcboeker/go-duckdb"
 	_ "github.com/mattn/go-sqlite3"
 	_ "github.com/microsoft/go-mssqldb"
 )
@@ -35,7 +36,8 @@ const (
 )
 
 var (
-	testDBs = map[string]*sqlx.DB{}
+	testDBs         = map[string]*sqlx.DB{}
+	testDataSources = map[string]string{}
 )
 
 func TestMain(m *testing.M) {
@@ -113,6 +115,7 @@ func loadEnvfile() map[string]string {
 func getDataSources(envMap map[string]string) map[string]string {
 	return map[string]string{
 		"sqlite3": "file:test.db?cache=shared&mode=memory",
+		"duckdb":  "",
 		"mysql": fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
 			envMap["TEST_DATABASE_USER"],
 			envMap["TEST_DATABASE_PASSWORD"],
@@ -159,4 +162,5 @@ func loadDB(dataSources map[string]string, driverName string) {
 	}
 
 	testDBs[driverName] = db
+	testDataSources[driverName] = dataSourceName
 }
@@ -0,0 +1,200 @@
+// Copyright 2023 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadaptertest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// recorder  records the statements sent to the db, it is used to test the SQL of the databases
+// and the driver features which are not run by the tests, such as Oracle, CockroachDB and the COPY of lib/pq.
+// The queries with "COUNT(*)" return 1, the other queries return no rows, the statements affect 1 row.
+type recorder struct {
+	mu    sync.Mutex
+	stmts []string
+	// fail  returns the error of the statement, nil means it succeeds.
+	fail func(stmt string) error
+	// driver  the driver reported by the db, the adapter detects the features of some drivers by it.
+	driver driver.Driver
+}
+
+// newRecorderDB  open a db on the recorder, the driver name is only used by sqlx.
+func newRecorderDB(r *recorder, driverName string) *sqlx.DB {
+	return sqlx.NewDb(sql.OpenDB(recordConnector{r}), driverName)
+}
+
+// record  record the statement and return the error of it.
+func (r *recorder) record(stmt string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmts = append(r.stmts, stmt)
+
+	if r.fail != nil {
+		return r.fail(stmt)
+	}
+
+	return nil
+}
+
+// take  returns the recorded statements which contain the keyword, and clears all the statements.
+func (r *recorder) take(keyword string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stmts []string
+
+	for _, stmt := range r.stmts {
+		if strings.Contains(stmt, keyword) {
+			stmts = append(stmts, stmt)
+		}
+	}
+
+	r.stmts = nil
+
+	return stmts
+}
+
+type recordConnector struct {
+	r *recorder
+}
+
+func (c recordConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recordConn{r: c.r}, nil
+}
+
+func (c recordConnector) Driver() driver.Driver {
+	if c.r.driver != nil {
+		return c.r.driver
+	}
+
+	return recordDriver{}
+}
+
+type recordDriver struct{}
+
+func (recordDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("recorder: use the connector")
+}
+
+type recordConn struct {
+	r *recorder
+}
+
+func (c *recordConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordStmt{conn: c, query: query}, nil
+}
+
+func (c *recordConn) Close() error {
+	return nil
+}
+
+func (c *recordConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *recordConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	if err := c.r.record("BEGIN"); err != nil {
+		return nil, err
+	}
+
+	return recordTx{c.r}, nil
+}
+
+func (c *recordConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if err := c.r.record(query); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if err := c.r.record(query); err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(query, "COUNT(*)") {
+		return &recordRows{columns: []string{"count"}, values: [][]driver.Value{{int64(1)}}}, nil
+	}
+
+	return &recordRows{columns: []string{"p_type", "v0", "v1", "v2", "v3", "v4", "v5"}}, nil
+}
+
+// recordStmt  records the query every time it is executed.
+type recordStmt struct {
+	conn  *recordConn
+	query string
+}
+
+func (s *recordStmt) Close() error {
+	return nil
+}
+
+func (s *recordStmt) NumInput() int {
+	return -1
+}
+
+func (s *recordStmt) Exec([]driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, nil)
+}
+
+func (s *recordStmt) Query([]driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, nil)
+}
+
+type recordTx struct {
+	r *recorder
+}
+
+func (tx recordTx) Commit() error {
+	return tx.r.record("COMMIT")
+}
+
+func (tx recordTx) Rollback() error {
+	return tx.r.record("ROLLBACK")
+}
+
+type recordRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *recordRows) Columns() []string {
+	return r.columns
+}
+
+func (r *recordRows) Close() error {
+	return nil
+}
+
+func (r *recordRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+
+	return nil
+}
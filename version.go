@@ -0,0 +1,80 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// versionTableSuffix  the version table is named "<table>_version".
+const versionTableSuffix = "_version"
+
+// enableVersion  create the version table if it does not exist,
+// and bump the version in the transaction of every write.
+func (p *Adapter) enableVersion(ctx context.Context) error {
+	if p.sqlBumpVersion != "" {
+		return nil
+	}
+
+	versionTable := p.tableName + versionTableSuffix
+
+	sqlCreateTable := fmt.Sprintf(sqlCreateVersionTable, versionTable)
+	sqlInit := fmt.Sprintf(sqlInitVersion, versionTable)
+
+	switch p.dialect {
+	case DialectOracle:
+		sqlCreateTable = fmt.Sprintf(sqlCreateVersionTableOracle, versionTable)
+		sqlInit = fmt.Sprintf(sqlInitVersionFromDual, versionTable)
+	case DialectMysql:
+		sqlInit = fmt.Sprintf(sqlInitVersionFromDual, versionTable)
+	case DialectGeneric, DialectPostgres, DialectCockroach, DialectSqlite3, DialectSqlserver, DialectDuckdb:
+	}
+
+	if err := p.ensureTable(ctx, versionTable, sqlCreateTable); err != nil {
+		return err
+	}
+
+	if _, err := p.db.ExecContext(ctx, sqlInit); err != nil {
+		if err = p.dialect.classifyError(err); !errors.Is(err, ErrDuplicate) {
+			return err
+		}
+	}
+
+	p.sqlSelectVersion = fmt.Sprintf(sqlSelectVersion, versionTable)
+	p.sqlBumpVersion = fmt.Sprintf(sqlBumpVersion, versionTable)
+	p.writeHooks = append(p.writeHooks, p.bumpVersion)
+
+	return nil
+}
+
+// bumpVersion  the write hook to bump the version in the transaction.
+func (p *Adapter) bumpVersion(ctx context.Context, tx *sqlx.Tx, _ []*Change) error {
+	_, err := tx.ExecContext(ctx, p.sqlBumpVersion)
+
+	return err
+}
+
+// selectVersion  select the current version.
+func (p *Adapter) selectVersion(ctx context.Context) (int64, error) {
+	var version int64
+
+	err := p.db.GetContext(ctx, &version, p.sqlSelectVersion)
+
+	return version, err
+}
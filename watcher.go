@@ -0,0 +1,388 @@
+// Copyright 2020 by Blank-Xu. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlxadapter
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v3/model"
+	"github.com/casbin/casbin/v3/persist"
+)
+
+// defaultPollInterval  the default interval of the Watcher to poll the version.
+const defaultPollInterval = 5 * time.Second
+
+// poller  calls poll every interval in a goroutine until it is stopped.
+type poller struct {
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// startPoller  start a goroutine to call poll every interval, if interval <= 0, 5 seconds will be used.
+func startPoller(interval time.Duration, poll func(ctx context.Context)) *poller {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := &poller{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go p.run(ctx, interval, poll)
+
+	return p
+}
+
+// stop  stops polling and waits for the polling goroutine to exit.
+func (p *poller) stop(ctx context.Context) error {
+	p.closeOnce.Do(p.cancel)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.done:
+		return nil
+	}
+}
+
+// run  calls poll every interval until ctx is canceled.
+func (p *poller) run(ctx context.Context, interval time.Duration, poll func(ctx context.Context)) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			poll(ctx)
+		}
+	}
+}
+
+// pollFailed  call the error callback with the error of a poll,
+// the errors caused by stopping the poller are not passed.
+func pollFailed(ctx context.Context, errorCallback func(error), err error) {
+	if errorCallback != nil && ctx.Err() == nil {
+		errorCallback(err)
+	}
+}
+
+// Watcher  the polling watcher for Casbin, it works on every database.
+// The Adapter bumps the version in the "<table>_version" table in the transaction of every write,
+// the Watcher polls the version and calls the update callback when it changes.
+type Watcher struct {
+	adapter *Adapter
+	poller  *poller
+
+	mu            sync.Mutex
+	callback      func(string)
+	errorCallback func(error)
+	version       int64
+}
+
+var _ persist.Watcher = (*Watcher)(nil)
+
+// NewWatcher  the constructor for Watcher, it starts polling the version every interval,
+// if interval <= 0, 5 seconds will be used.
+//
+// The Adapter must be created with WithVersion or WithChangelog, which bump the version,
+// and every instance which writes the policy should be created with them.
+// The Watcher is closed by Watcher.Close or Adapter.Close.
+//
+// Example:
+//
+//	a, err := sqlxadapter.NewAdapter(db, "casbin_rule", sqlxadapter.WithVersion())
+//	...
+//	w, err := sqlxadapter.NewWatcher(a, 5*time.Second)
+//	if err != nil {
+//	    panic(err)
+//	}
+//	_ = e.SetWatcher(w)
+func NewWatcher(a *Adapter, interval time.Duration) (*Watcher, error) {
+	if err := a.acquire(); err != nil {
+		return nil, a.opError("NewWatcher", nil, err)
+	}
+	defer a.release()
+
+	if a.sqlBumpVersion == "" {
+		return nil, a.opError("NewWatcher", nil, ErrVersionDisabled)
+	}
+
+	version, err := a.selectVersion(a.ctx)
+	if err != nil {
+		return nil, a.opError("NewWatcher", nil, err)
+	}
+
+	w := &Watcher{
+		adapter: a,
+		version: version,
+	}
+
+	w.poller = startPoller(interval, w.poll)
+
+	if err = a.onClose(a.ctx, w.poller.stop); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// SetUpdateCallback  sets the callback function called when the version is changed by any instance,
+// the version is passed to the callback.
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	w.callback = callback
+	w.mu.Unlock()
+
+	return nil
+}
+
+// SetErrorCallback  sets the callback function called with the error when a poll fails,
+// such as the db is unavailable or the version table is dropped, the version is polled again at the next tick.
+func (w *Watcher) SetErrorCallback(callback func(error)) {
+	w.mu.Lock()
+	w.errorCallback = callback
+	w.mu.Unlock()
+}
+
+// Update  does nothing, the version has been bumped by the Adapter in the transaction of the write.
+func (w *Watcher) Update() error {
+	return nil
+}
+
+// Close  stops polling the version, the callback function will not be called any more.
+func (w *Watcher) Close() {
+	_ = w.poller.stop(context.Background())
+}
+
+// poll  select the version and call the callback if it changed,
+// the errors are passed to the error callback and it will be polled again at the next tick.
+func (w *Watcher) poll(ctx context.Context) {
+	version, err := w.adapter.selectVersion(ctx)
+	if err != nil {
+		w.mu.Lock()
+		errorCallback := w.errorCallback
+		w.mu.Unlock()
+
+		pollFailed(ctx, errorCallback, w.adapter.opError("Watcher", nil, err))
+
+		return
+	}
+
+	w.mu.Lock()
+
+	if version == w.version {
+		w.mu.Unlock()
+
+		return
+	}
+
+	w.version = version
+	callback := w.callback
+	w.mu.Unlock()
+
+	if callback != nil && ctx.Err() == nil {
+		callback(strconv.FormatInt(version, 10))
+	}
+}
+
+// updateForNoop  implements the UpdateFor* methods of persist.WatcherEx which do nothing,
+// the changes have been published by the Adapter in the transaction of the write.
+type updateForNoop struct{}
+
+// UpdateForAddPolicy  does nothing.
+func (updateForNoop) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return nil
+}
+
+// UpdateForRemovePolicy  does nothing.
+func (updateForNoop) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return nil
+}
+
+// UpdateForRemoveFilteredPolicy  does nothing.
+func (updateForNoop) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return nil
+}
+
+// UpdateForSavePolicy  does nothing.
+func (updateForNoop) UpdateForSavePolicy(model model.Model) error {
+	return nil
+}
+
+// UpdateForAddPolicies  does nothing.
+func (updateForNoop) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return nil
+}
+
+// UpdateForRemovePolicies  does nothing.
+func (updateForNoop) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return nil
+}
+
+// ChangelogWatcher  the polling watcher for Casbin which tails the change log,
+// the Adapter must be created with WithChangelog.
+// It polls the changes made by the other instances by the sequence number,
+// and passes them to the change callback in order, so the enforcer can apply them incrementally.
+// The ChangelogWatcher of the Adapter returned by ForTenant only passes the changes of the tenant.
+type ChangelogWatcher struct {
+	updateForNoop
+
+	adapter *Adapter
+	poller  *poller
+
+	mu             sync.Mutex
+	callback       func(string)
+	changeCallback func(Change)
+	errorCallback  func(error)
+	seq            int64
+}
+
+var _ persist.WatcherEx = (*ChangelogWatcher)(nil)
+
+// NewChangelogWatcher  the constructor for ChangelogWatcher,
+// it starts tailing the change log from the current sequence number every interval,
+// if interval <= 0, 5 seconds will be used.
+// The ChangelogWatcher is closed by ChangelogWatcher.Close or Adapter.Close.
+//
+// Example:
+//
+//	a, err := sqlxadapter.NewAdapter(db, "casbin_rule", sqlxadapter.WithChangelog())
+//	...
+//	w, err := sqlxadapter.NewChangelogWatcher(a, 5*time.Second)
+//	...
+//	_ = e.SetWatcher(w)
+//	w.SetChangeCallback(func(c sqlxadapter.Change) {
+//	    _ = sqlxadapter.ApplyChange(e, c)
+//	})
+func NewChangelogWatcher(a *Adapter, interval time.Duration) (*ChangelogWatcher, error) {
+	if err := a.acquire(); err != nil {
+		return nil, a.opError("NewChangelogWatcher", nil, err)
+	}
+	defer a.release()
+
+	if a.sqlSelectChangelog == "" {
+		return nil, a.opError("NewChangelogWatcher", nil, ErrChangelogDisabled)
+	}
+
+	seq, err := a.selectVersion(a.ctx)
+	if err != nil {
+		return nil, a.opError("NewChangelogWatcher", nil, err)
+	}
+
+	w := &ChangelogWatcher{
+		adapter: a,
+		seq:     seq,
+	}
+
+	w.poller = startPoller(interval, w.poll)
+
+	if err = a.onClose(a.ctx, w.poller.stop); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// SetUpdateCallback  sets the callback function called with the sequence number
+// when the other instances changed the policy rules and no change callback is set.
+func (w *ChangelogWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	w.callback = callback
+	w.mu.Unlock()
+
+	return nil
+}
+
+// SetChangeCallback  sets the callback function called with every change made by the other instances,
+// in the order of the sequence number and the index, ApplyChange can be used to apply it.
+func (w *ChangelogWatcher) SetChangeCallback(callback func(Change)) {
+	w.mu.Lock()
+	w.changeCallback = callback
+	w.mu.Unlock()
+}
+
+// SetErrorCallback  sets the callback function called with the error when a poll fails,
+// such as the db is unavailable or the change log table is dropped, the changes are polled again at the next tick.
+func (w *ChangelogWatcher) SetErrorCallback(callback func(error)) {
+	w.mu.Lock()
+	w.errorCallback = callback
+	w.mu.Unlock()
+}
+
+// Update  does nothing.
+func (w *ChangelogWatcher) Update() error {
+	return nil
+}
+
+// Close  stops tailing the change log, the callback functions will not be called any more.
+func (w *ChangelogWatcher) Close() {
+	_ = w.poller.stop(context.Background())
+}
+
+// poll  select the changes after the last sequence number and call the callbacks,
+// the errors are passed to the error callback and the changes will be polled again at the next tick.
+func (w *ChangelogWatcher) poll(ctx context.Context) {
+	// poll is only called by the polling goroutine, so w.seq is not changed by the others.
+	w.mu.Lock()
+	from, errorCallback := w.seq, w.errorCallback
+	w.mu.Unlock()
+
+	seq, err := w.adapter.selectVersion(ctx)
+	if err != nil {
+		pollFailed(ctx, errorCallback, w.adapter.opError("ChangelogWatcher", nil, err))
+
+		return
+	}
+
+	if seq == from {
+		return
+	}
+
+	// the changes are committed with the version, so all the changes before seq are visible.
+	changes, err := w.adapter.selectChangelog(ctx, from, seq)
+	if err != nil {
+		pollFailed(ctx, errorCallback, w.adapter.opError("ChangelogWatcher", nil, err))
+
+		return
+	}
+
+	w.mu.Lock()
+	w.seq = seq
+	callback, changeCallback := w.callback, w.changeCallback
+	w.mu.Unlock()
+
+	if len(changes) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	if changeCallback != nil {
+		for _, change := range changes {
+			changeCallback(*change)
+		}
+	} else if callback != nil {
+		callback(strconv.FormatInt(seq, 10))
+	}
+}